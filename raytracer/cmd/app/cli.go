@@ -0,0 +1,623 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/philippkk/coms336/raytracer/internal/utils"
+)
+
+type sceneEntry struct {
+	build       func() (Scene, error)
+	description string
+}
+
+// scenes maps the names accepted by -scene to their builders
+var scenes = map[string]sceneEntry{
+	"cornell": {CreateCornellBox, "Cornell box with two boxes and an area light"},
+	"quads":   {createQuadsScene, "five coloured quads"},
+	"random":  {createRandomScene, "grid of random smoke balls"},
+	"model":   {createModelScene, "dakar OBJ model (needs internal/model/dakar.obj)"},
+	"quadric": {createQuadricScene, "quadric sphere, cylinder and cone"},
+}
+
+func sceneNames() []string {
+	names := make([]string, 0, len(scenes))
+	for name := range scenes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func listScenes() {
+	for _, name := range sceneNames() {
+		fmt.Printf("  %-10s %s\n", name, scenes[name].description)
+	}
+}
+
+// vec3Flag parses "x,y,z" into a Vec3
+type vec3Flag struct {
+	v *utils.Vec3
+}
+
+func (f vec3Flag) String() string {
+	if f.v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%g,%g,%g", f.v.X, f.v.Y, f.v.Z)
+}
+
+func (f vec3Flag) Set(s string) error {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return fmt.Errorf("expected x,y,z but got %q", s)
+	}
+	var xyz [3]float64
+	for i, part := range parts {
+		val, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return fmt.Errorf("bad component %q: %v", part, err)
+		}
+		xyz[i] = val
+	}
+	*f.v = utils.Vec3{X: xyz[0], Y: xyz[1], Z: xyz[2]}
+	return nil
+}
+
+// exposureTimeFlag parses an exposure time in seconds, either as a number or
+// as a fraction like 1/60
+type exposureTimeFlag struct {
+	v *float64
+}
+
+func (f exposureTimeFlag) String() string {
+	if f.v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f.v, 'g', -1, 64)
+}
+
+func (f exposureTimeFlag) Set(s string) error {
+	seconds, err := parseExposureTime(s)
+	if err != nil {
+		return err
+	}
+	*f.v = seconds
+	return nil
+}
+
+func parseExposureTime(s string) (float64, error) {
+	num, den, isFraction := strings.Cut(s, "/")
+	n, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad exposure time %q: %v", s, err)
+	}
+	d := 1.0
+	if isFraction {
+		d, err = strconv.ParseFloat(strings.TrimSpace(den), 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad exposure time %q: %v", s, err)
+		}
+	}
+	if n <= 0 || d <= 0 {
+		return 0, fmt.Errorf("exposure time %q must be positive", s)
+	}
+	return n / d, nil
+}
+
+// cameraChecks are the rules for camera settings, keyed by their name in a
+// scene file. The scene loader and the command line both check with them so
+// they accept the same values.
+var cameraChecks = map[string]func(float64) error{
+	"aspect_ratio":             positive,
+	"image_width":              positive,
+	"samples_per_pixel":        positive,
+	"max_depth":                notNegative,
+	"vfov":                     below(180, "degrees"),
+	"noise_threshold":          notNegative,
+	"min_samples":              positive,
+	"denoise.strength":         notNegative,
+	"denoise.iterations":       notNegative,
+	"filter_radius":            positive,
+	"white_point":              positive,
+	"ortho_height":             positive,
+	"fisheye_fov":              upTo(360, "degrees"),
+	"interocular_distance":     positive,
+	"convergence":              positive,
+	"physical.f_stop":          notNegative,
+	"physical.focal_length":    notNegative,
+	"physical.sensor_width":    notNegative,
+	"physical.exposure_time":   notNegative,
+	"physical.iso":             notNegative,
+	"physical.units_per_meter": notNegative,
+	"aperture.blades":          notNegative,
+	"aperture.cat_eye":         notNegative,
+}
+
+// flagSettings maps flags to the camera setting whose rule they follow
+var flagSettings = map[string]string{
+	"width":              "image_width",
+	"spp":                "samples_per_pixel",
+	"depth":              "max_depth",
+	"vfov":               "vfov",
+	"noise":              "noise_threshold",
+	"min-spp":            "min_samples",
+	"denoise-strength":   "denoise.strength",
+	"denoise-iterations": "denoise.iterations",
+	"filter-radius":      "filter_radius",
+	"white":              "white_point",
+	"ortho-height":       "ortho_height",
+	"fisheye-fov":        "fisheye_fov",
+	"iod":                "interocular_distance",
+	"convergence":        "convergence",
+	"fstop":              "physical.f_stop",
+	"focal-length":       "physical.focal_length",
+	"sensor-width":       "physical.sensor_width",
+	"exposure-time":      "physical.exposure_time",
+	"iso":                "physical.iso",
+	"units-per-meter":    "physical.units_per_meter",
+	"aperture-blades":    "aperture.blades",
+	"cat-eye":            "aperture.cat_eye",
+}
+
+// physicalFlags only refine a physical camera
+var physicalFlags = []string{"fstop", "focal-length", "sensor-width", "exposure-time", "iso", "units-per-meter"}
+
+func positive(v float64) error {
+	if !(v > 0) {
+		return errors.New("must be positive")
+	}
+	return nil
+}
+
+func notNegative(v float64) error {
+	if !(v >= 0) {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+// upTo accepts positive values no larger than limit
+func upTo(limit float64, unit string) func(float64) error {
+	return func(v float64) error {
+		if !(v > 0 && v <= limit) {
+			return fmt.Errorf("must be between 0 and %g %s", limit, unit)
+		}
+		return nil
+	}
+}
+
+// below accepts positive values smaller than limit
+func below(limit float64, unit string) func(float64) error {
+	return func(v float64) error {
+		if !(v > 0 && v < limit) {
+			return fmt.Errorf("must be between 0 and %g %s", limit, unit)
+		}
+		return nil
+	}
+}
+
+// checkFilter rejects box filters narrower than a pixel, they would leave
+// most samples out of every pixel
+func checkFilter(f utils.PixelFilter) error {
+	if f.Type == utils.BoxFilter && f.Radius != 0 && f.Radius < 0.5 {
+		return errors.New("must be at least 0.5 for a box filter")
+	}
+	return nil
+}
+
+// checkShutter rejects a motion blur shutter that closes before it opens
+func checkShutter(c *utils.Camera) error {
+	if c.ShutterClose < c.ShutterOpen {
+		return errors.New("must not be before the shutter opens")
+	}
+	return nil
+}
+
+// checkStereo rejects stereo images that don't split evenly, one eye would
+// get an extra column or row its viewport doesn't cover
+func checkStereo(c *utils.Camera) error {
+	switch {
+	case c.Stereo == utils.StereoSideBySide && c.ImageWidth%2 != 0:
+		return fmt.Errorf("needs an even image width, got %d", c.ImageWidth)
+	case c.Stereo == utils.StereoOverUnder && c.ImageHeight()%2 != 0:
+		return fmt.Errorf("needs an even image height, got %d from the width and aspect ratio", c.ImageHeight())
+	}
+	return nil
+}
+
+// checkFlag checks a flag against the rule of its camera setting
+func checkFlag(f *flag.Flag) error {
+	setting, ok := flagSettings[f.Name]
+	if !ok {
+		return nil
+	}
+	v, err := strconv.ParseFloat(f.Value.String(), 64)
+	if err != nil {
+		return fmt.Errorf("-%s: %v", f.Name, err)
+	}
+	if err := cameraChecks[setting](v); err != nil {
+		return fmt.Errorf("-%s %v", f.Name, err)
+	}
+	return nil
+}
+
+type options struct {
+	scene       string
+	sceneFile   string
+	width       int
+	spp         int
+	depth       int
+	seed        uint64
+	noise       float64
+	minSpp      int
+	heatmap     string
+	progressive bool
+	timeBudget  time.Duration
+	sampler     utils.SamplerType
+	toneMap     utils.ToneMapOperator
+	aovs        []utils.AOV
+	filter      utils.PixelFilter
+	projection  utils.Projection
+	orthoHeight float64
+	fisheyeFOV  float64
+	cubeFace    int
+	stereo      utils.StereoMode
+	iod         float64
+	convergence float64
+	physical    bool
+	camera      utils.PhysicalCamera
+	aperture    utils.Aperture
+	openTime    float64
+	closeTime   float64
+	curve       utils.ShutterCurve
+	denoise     bool
+	denoiser    utils.Denoiser
+	exposure    float64
+	whitePoint  float64
+	vfov        float64
+	lookFrom    utils.Vec3
+	lookAt      utils.Vec3
+	cubeMapDir  string
+	output      string
+	exrFloat    bool
+	headless    bool
+	bvh         string
+
+	// set records which flags were given on the command line so only those override the scene
+	set map[string]bool
+}
+
+func parseOptions(args []string) options {
+	var opts options
+
+	fs := flag.NewFlagSet("tracer", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: tracer [flags]\n       tracer list-scenes\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.scene, "scene", "cornell", "scene to render, see list-scenes")
+	fs.StringVar(&opts.sceneFile, "scene-file", "", "load the scene from a JSON scene file instead of -scene")
+	fs.IntVar(&opts.width, "width", 0, "image width in pixels (default: scene setting)")
+	fs.IntVar(&opts.spp, "spp", 0, "samples per pixel (default: scene setting)")
+	fs.IntVar(&opts.depth, "depth", 0, "max ray bounces (default: scene setting)")
+	samplerName := fs.String("sampler", "", "sample generator: random, sobol, halton or stratified (default: scene setting or random)")
+	fs.Float64Var(&opts.noise, "noise", 0, "adaptive sampling noise threshold, e.g. 0.01; 0 takes -spp samples everywhere (default: scene setting)")
+	fs.IntVar(&opts.minSpp, "min-spp", 0, "samples every pixel takes before adaptive sampling may stop it (default: scene setting or 16)")
+	fs.StringVar(&opts.heatmap, "heatmap", "", "also save a PNG of the samples taken per pixel")
+	toneMapName := fs.String("tonemap", "", "tone mapping operator: aces, clamp, reinhard, reinhard-extended, hable or agx (default: scene setting or aces)")
+	fs.Float64Var(&opts.exposure, "exposure", 0, "exposure in stops applied before tone mapping (default: scene setting or 0)")
+	fs.Float64Var(&opts.whitePoint, "white", 0, "linear value shown as white by clamp, reinhard-extended and hable (default: scene setting)")
+	aovList := fs.String("aov", "", "auxiliary passes to save: albedo, normal, position, depth, uv, material_id, object_id or all, comma separated; EXR output gets them as layers, other formats as extra PNGs (default: scene setting)")
+	fs.BoolVar(&opts.denoise, "denoise", false, "filter the noise out of previews and saved images, guided by the albedo, normal and depth AOVs (default: scene setting)")
+	fs.Float64Var(&opts.denoiser.Strength, "denoise-strength", 1, "how strongly -denoise smooths, higher blends more different colors")
+	fs.IntVar(&opts.denoiser.Iterations, "denoise-iterations", 4, "filter passes -denoise runs, each doubles how far it reaches")
+	filterName := fs.String("filter", "", "pixel reconstruction filter: box, tent, gaussian or mitchell (default: scene setting or box)")
+	fs.Float64Var(&opts.filter.Radius, "filter-radius", 0, "reconstruction filter radius in pixels (default: scene setting or the filter's own)")
+	fs.Uint64Var(&opts.seed, "seed", 0, "random seed, the same seed renders the same image (default: scene setting)")
+	fs.Float64Var(&opts.vfov, "vfov", 0, "vertical field of view in degrees (default: scene setting)")
+	projectionName := fs.String("projection", "", "camera projection: perspective, orthographic, equirectangular, fisheye or cube; headless cube renders write all six faces as posx, negx... into the directory -o names without its extension, as JPEGs when it has none (default: scene setting or perspective)")
+	fs.Float64Var(&opts.orthoHeight, "ortho-height", 0, "height in world units an orthographic camera sees (default: scene setting or what -vfov sees at the focus distance)")
+	fs.Float64Var(&opts.fisheyeFOV, "fisheye-fov", 0, "degrees the fisheye image circle covers (default: scene setting or 180)")
+	cubeFaceName := fs.String("cube-face", "", "single cube face to render: posx, negx, posy, negy, posz or negz (default: all six headless, posz in the window)")
+	stereoName := fs.String("stereo", "", "stereo layout: off, side-by-side or over-under; -width and the aspect ratio are those of the composed image and must split it evenly, equirectangular and cube renders use omnidirectional stereo (default: scene setting or off)")
+	fs.Float64Var(&opts.iod, "iod", 0, "interocular distance in world units for -stereo (default: scene setting or 0.065)")
+	fs.Float64Var(&opts.convergence, "convergence", 0, "distance at which the stereo eyes' views meet (default: scene setting or the focus distance)")
+	fs.BoolVar(&opts.physical, "physical", false, "physical camera: focal length, sensor and f-stop give the field of view and depth of field, f-stop, exposure time and ISO the brightness (default: scene setting)")
+	fs.Float64Var(&opts.camera.FStop, "fstop", 0, "f-number of the -physical camera (default: scene setting or 2.8)")
+	fs.Float64Var(&opts.camera.FocalLength, "focal-length", 0, "focal length of the -physical camera in mm (default: scene setting or 50)")
+	fs.Float64Var(&opts.camera.SensorWidth, "sensor-width", 0, "sensor width of the -physical camera in mm (default: scene setting or 36)")
+	fs.Var(exposureTimeFlag{&opts.camera.ExposureTime}, "exposure-time", "exposure time of the -physical camera in seconds, like 1/60 or 0.5; only sets the brightness, -shutter-open and -shutter-close set the motion blur (default: scene setting or 1/60)")
+	fs.Float64Var(&opts.camera.ISO, "iso", 0, "sensitivity of the -physical camera (default: scene setting or 100)")
+	fs.Float64Var(&opts.camera.UnitsPerMeter, "units-per-meter", 0, "world units in a meter, sizes the -physical camera's lens opening (default: scene setting or 1)")
+	fs.IntVar(&opts.aperture.Blades, "aperture-blades", 0, "aperture blades, 3 or more give polygonal bokeh (default: scene setting or round)")
+	fs.Float64Var(&opts.aperture.Rotation, "aperture-rotation", 0, "rotation of the aperture blades or mask in degrees (default: scene setting)")
+	apertureMask := fs.String("aperture-mask", "", "image of the aperture shape for custom bokeh, white lets light through (default: scene setting)")
+	fs.Float64Var(&opts.aperture.CatEye, "cat-eye", 0, "cat-eye vignetting from the lens barrel, 0 is off and 0.5 looks like a fast lens wide open (default: scene setting)")
+	fs.Float64Var(&opts.openTime, "shutter-open", 0, "scene time the shutter opens at for motion blur, independent of -exposure-time (default: scene setting or 0)")
+	fs.Float64Var(&opts.closeTime, "shutter-close", 0, "scene time the shutter closes at for motion blur, independent of -exposure-time (default: scene setting or 1)")
+	curveName := fs.String("shutter-curve", "", "how the shutter opens and closes: box, triangle or smooth (default: scene setting or box)")
+	fs.Var(vec3Flag{&opts.lookFrom}, "from", "camera position as x,y,z (default: scene setting)")
+	fs.Var(vec3Flag{&opts.lookAt}, "at", "camera target as x,y,z (default: scene setting)")
+	fs.StringVar(&opts.cubeMapDir, "cubemap", "internal/utils/cube_map_images", "directory holding posx/negx/posy/negy/posz/negz.jpg")
+	fs.StringVar(&opts.output, "o", "output.png", "output image file, .exr and .hdr keep the linear HDR values, .jpg is saved as JPEG and anything else as PNG")
+	fs.BoolVar(&opts.exrFloat, "exr-float", false, "store EXR channels as 32 bit floats instead of half floats")
+	fs.BoolVar(&opts.headless, "headless", false, "render once to the output file without opening a window")
+	fs.BoolVar(&opts.progressive, "progressive", false, "refine the preview window one sample per pixel at a time instead of rendering full frames")
+	fs.DurationVar(&opts.timeBudget, "time-budget", 0, "stop refining after this long, e.g. 30s; applies to headless renders and -progressive previews (default: run until -spp)")
+	fs.StringVar(&opts.bvh, "bvh", "median", "BVH builder: median (longest axis split) or sah (binned surface area heuristic)")
+
+	if len(args) > 0 && args[0] == "list-scenes" {
+		listScenes()
+		os.Exit(0)
+	}
+
+	fs.Parse(args)
+
+	if _, ok := scenes[opts.scene]; !ok {
+		fmt.Fprintf(os.Stderr, "unknown scene %q, available scenes:\n", opts.scene)
+		listScenes()
+		os.Exit(2)
+	}
+
+	if opts.bvh != "sah" && opts.bvh != "median" {
+		fmt.Fprintf(os.Stderr, "unknown BVH builder %q, expected sah or median\n", opts.bvh)
+		os.Exit(2)
+	}
+
+	if *samplerName != "" {
+		sampler, err := utils.ParseSamplerType(*samplerName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts.sampler = sampler
+	}
+
+	if *toneMapName != "" {
+		toneMap, err := utils.ParseToneMapOperator(*toneMapName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts.toneMap = toneMap
+	}
+
+	if *projectionName != "" {
+		projection, err := utils.ParseProjection(*projectionName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts.projection = projection
+	}
+
+	if *cubeFaceName != "" {
+		face, err := utils.ParseCubeFace(*cubeFaceName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts.cubeFace = face
+	}
+
+	if *stereoName != "" {
+		stereo, err := utils.ParseStereoMode(*stereoName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts.stereo = stereo
+	}
+
+	if *apertureMask != "" {
+		mask, err := utils.NewApertureMask(*apertureMask)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts.aperture.Mask = mask
+	}
+
+	if *curveName != "" {
+		curve, err := utils.ParseShutterCurve(*curveName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts.curve = curve
+	}
+
+	if *filterName != "" {
+		filter, err := utils.ParseFilterType(*filterName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts.filter.Type = filter
+	}
+
+	if *aovList != "" {
+		aovs, err := utils.ParseAOVs(*aovList)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts.aovs = aovs
+	}
+
+	opts.set = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		opts.set[f.Name] = true
+		if err := checkFlag(f); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	})
+	return opts
+}
+
+// apply overrides the scene camera with anything given on the command line.
+// It fails when a flag only refines a feature that neither the command line
+// nor the scene turns on.
+func (o options) apply(c *utils.Camera) error {
+	if o.set["width"] {
+		c.ImageWidth = o.width
+	}
+	if o.set["spp"] {
+		c.SamplesPerPixel = o.spp
+	}
+	if o.set["depth"] {
+		c.MaxDepth = o.depth
+	}
+	if o.set["sampler"] {
+		c.Sampler = o.sampler
+	}
+	if o.set["noise"] {
+		c.NoiseThreshold = o.noise
+	}
+	if o.set["min-spp"] {
+		c.MinSamples = o.minSpp
+	}
+	if o.set["tonemap"] {
+		c.ToneMap.Operator = o.toneMap
+	}
+	if o.set["exposure"] {
+		c.ToneMap.Exposure = o.exposure
+	}
+	if o.set["white"] {
+		c.ToneMap.WhitePoint = o.whitePoint
+	}
+	if o.set["filter"] {
+		c.Filter.Type = o.filter.Type
+	}
+	if o.set["filter-radius"] {
+		c.Filter.Radius = o.filter.Radius
+	}
+	if err := checkFilter(c.Filter); err != nil {
+		return fmt.Errorf("-filter-radius %v", err)
+	}
+	if o.set["aov"] {
+		c.AOVs = o.aovs
+	}
+	if o.set["denoise"] {
+		c.Denoiser = nil
+		if o.denoise {
+			c.Denoiser = &utils.Denoiser{}
+		}
+	}
+	if c.Denoiser == nil && (o.set["denoise-strength"] || o.set["denoise-iterations"]) {
+		return errors.New("-denoise-strength and -denoise-iterations need -denoise or a scene that denoises")
+	}
+	if o.set["denoise-strength"] {
+		c.Denoiser.Strength = o.denoiser.Strength
+	}
+	if o.set["denoise-iterations"] {
+		c.Denoiser.Iterations = o.denoiser.Iterations
+	}
+	if o.set["seed"] {
+		c.Seed = o.seed
+	}
+	if o.set["vfov"] {
+		c.Vfov = o.vfov
+	}
+	if o.set["projection"] {
+		c.Projection = o.projection
+	}
+	if o.set["ortho-height"] {
+		c.OrthoHeight = o.orthoHeight
+	}
+	if o.set["fisheye-fov"] {
+		c.FisheyeFOV = o.fisheyeFOV
+	}
+	if o.set["cube-face"] {
+		c.CubeFace = o.cubeFace
+	}
+	if o.set["stereo"] {
+		c.Stereo = o.stereo
+	}
+	if o.set["iod"] {
+		c.InterocularDistance = o.iod
+	}
+	if o.set["convergence"] {
+		c.Convergence = o.convergence
+	}
+	if o.set["physical"] {
+		c.Physical = nil
+		if o.physical {
+			c.Physical = &utils.PhysicalCamera{}
+		}
+	}
+	for _, name := range physicalFlags {
+		if c.Physical == nil && o.set[name] {
+			return fmt.Errorf("-%s needs -physical or a scene with a physical camera", name)
+		}
+	}
+	if c.Physical != nil {
+		if o.set["fstop"] {
+			c.Physical.FStop = o.camera.FStop
+		}
+		if o.set["focal-length"] {
+			c.Physical.FocalLength = o.camera.FocalLength
+		}
+		if o.set["sensor-width"] {
+			c.Physical.SensorWidth = o.camera.SensorWidth
+		}
+		if o.set["exposure-time"] {
+			c.Physical.ExposureTime = o.camera.ExposureTime
+		}
+		if o.set["iso"] {
+			c.Physical.ISO = o.camera.ISO
+		}
+		if o.set["units-per-meter"] {
+			c.Physical.UnitsPerMeter = o.camera.UnitsPerMeter
+		}
+	}
+	if o.set["aperture-blades"] {
+		c.Aperture.Blades = o.aperture.Blades
+	}
+	if o.set["aperture-rotation"] {
+		c.Aperture.Rotation = o.aperture.Rotation
+	}
+	if o.set["aperture-mask"] {
+		c.Aperture.Mask = o.aperture.Mask
+	}
+	if o.set["cat-eye"] {
+		c.Aperture.CatEye = o.aperture.CatEye
+	}
+	if o.set["shutter-open"] || o.set["shutter-close"] {
+		// Giving only one end keeps the other at its default
+		if c.ShutterOpen == 0 && c.ShutterClose == 0 {
+			c.ShutterClose = 1
+		}
+		if o.set["shutter-open"] {
+			c.ShutterOpen = o.openTime
+		}
+		if o.set["shutter-close"] {
+			c.ShutterClose = o.closeTime
+		}
+		if err := checkShutter(c); err != nil {
+			return fmt.Errorf("-shutter-close %v", err)
+		}
+	}
+	if o.set["shutter-curve"] {
+		c.ShutterCurve = o.curve
+	}
+	if o.set["from"] {
+		c.LookFrom = o.lookFrom
+	}
+	if o.set["at"] {
+		c.LookAt = o.lookAt
+	}
+	if err := checkStereo(c); err != nil {
+		return fmt.Errorf("-stereo %v %v", c.Stereo, err)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/gopxl/pixel/v2"
 	"github.com/gopxl/pixel/v2/backends/opengl"
@@ -9,13 +10,17 @@ import (
 	"github.com/philippkk/coms336/raytracer/internal/utils"
 	"github.com/philippkk/coms336/raytracer/internal/utils/material"
 	"image"
-	"image/color"
+	"image/jpeg"
 	"image/png"
+	"io"
 	"math"
-	"math/rand/v2"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -24,6 +29,17 @@ var world utils.HittableList
 var cam utils.Camera
 
 var reRender bool
+var outputFile string
+var heatmapFile string
+var exrFloat bool
+var progressive bool
+var timeBudget time.Duration
+
+// allCubeFaces makes a headless cube projection render every face
+var allCubeFaces bool
+
+// rootCtx is cancelled by Ctrl-C, renders then stop and save what they have
+var rootCtx context.Context
 
 type Scene struct {
 	World          utils.HittableList
@@ -43,7 +59,7 @@ func createDefaultCam() utils.Camera {
 		Focusdist:       5,
 	}
 }
-func CreateCornellBox() Scene {
+func CreateCornellBox() (Scene, error) {
 	var config Scene
 
 	// Materials
@@ -95,19 +111,29 @@ func CreateCornellBox() Scene {
 		white,
 	))
 
-	for _, box := range objects.CreateBox(
-		utils.Vec3{130, 0, 65},
-		utils.Vec3{295, 165, 230},
-		white) {
-		config.World.Add(box)
+	// The two boxes from the reference scene, built at the origin and then
+	// rotated into place
+	box1 := &utils.HittableList{}
+	for _, side := range objects.CreateBox(utils.Vec3{}, utils.Vec3{165, 330, 165}, white) {
+		box1.Add(side)
+	}
+	placed1, err := utils.NewTransform(box1,
+		utils.Translation(utils.Vec3{265, 0, 295}).Mul(utils.RotationY(15)))
+	if err != nil {
+		return Scene{}, err
 	}
+	config.World.Add(placed1)
 
-	for _, box := range objects.CreateBox(
-		utils.Vec3{265, 0, 295},
-		utils.Vec3{430, 330, 460},
-		white) {
-		config.World.Add(box)
+	box2 := &utils.HittableList{}
+	for _, side := range objects.CreateBox(utils.Vec3{}, utils.Vec3{165, 165, 165}, white) {
+		box2.Add(side)
 	}
+	placed2, err := utils.NewTransform(box2,
+		utils.Translation(utils.Vec3{130, 0, 65}).Mul(utils.RotationY(-18)))
+	if err != nil {
+		return Scene{}, err
+	}
+	config.World.Add(placed2)
 
 	// Camera settings
 	config.Cam = utils.Camera{
@@ -126,10 +152,10 @@ func CreateCornellBox() Scene {
 	// Scene settings
 	config.SkipBackground = true
 
-	return config
+	return config, nil
 }
 
-func createQuadsScene() Scene {
+func createQuadsScene() (Scene, error) {
 	var scene Scene
 
 	// Materials
@@ -192,20 +218,26 @@ func createQuadsScene() Scene {
 	// Set black background
 	scene.SkipBackground = false
 
-	return scene
+	return scene, nil
 }
-func createRandomScene() Scene {
+
+// randomSceneSeed fixes the random scene's layout, so -seed only changes the
+// samples and not the scene itself
+const randomSceneSeed = 42
+
+func createRandomScene() (Scene, error) {
 	var scene Scene
 	scene.World = utils.HittableList{}
+	rng := utils.NewRNG(randomSceneSeed)
 
 	num := 2
 	for a := -num; a < num; a++ {
 		for b := -num; b < num; b++ {
-			chooseMat := rand.Float64()
+			chooseMat := rng.Float64()
 			center := utils.Vec3{
-				X: float64(a) + 0.9*rand.Float64(),
+				X: float64(a) + 0.9*rng.Float64(),
 				Y: 0.2,
-				Z: float64(b) + 0.9*rand.Float64(),
+				Z: float64(b) + 0.9*rng.Float64(),
 			}
 
 			if center.MinusEq(utils.Vec3{4, 0.2, 0}).Length() > 0.9 {
@@ -213,16 +245,16 @@ func createRandomScene() Scene {
 
 				if chooseMat < 0.8 {
 					// Diffuse
-					albedo := utils.Vec3{rand.Float64(), rand.Float64(), rand.Float64()}
+					albedo := utils.Vec3{rng.Float64(), rng.Float64(), rng.Float64()}
 					sphereMaterial = material.NewLambertianFromColor(albedo)
 				} else if chooseMat < 0.95 {
 					// Metal
 					albedo := utils.Vec3{
-						rand.Float64()*0.5 + 0.5,
-						rand.Float64()*0.5 + 0.5,
-						rand.Float64()*0.5 + 0.5,
+						rng.Float64()*0.5 + 0.5,
+						rng.Float64()*0.5 + 0.5,
+						rng.Float64()*0.5 + 0.5,
 					}
-					fuzz := rand.Float64() * 0.5
+					fuzz := rng.Float64() * 0.5
 					sphereMaterial = material.Metal{Albedo: albedo, Fuzz: fuzz}
 				} else {
 					// Glass
@@ -252,14 +284,17 @@ func createRandomScene() Scene {
 	scene.Cam.LookAt = utils.Vec3{-2, 0, -1}
 	scene.Cam.Vup = utils.Vec3{Y: 1}
 
-	return scene
+	return scene, nil
 }
 
-func createModelScene() Scene {
+func createModelScene() (Scene, error) {
 	var scene Scene
 
 	fmt.Println("Loading file")
-	newmod := model.NewModel("internal/model/dakar.obj", "internal/model/dakar.mtl")
+	newmod, err := model.LoadModel(rootCtx, "internal/model/dakar.obj", "internal/model/dakar.mtl")
+	if err != nil {
+		return Scene{}, err
+	}
 	fmt.Printf("done!")
 
 	defaultMat := material.Dielectric{RefractionIndex: 1.520}
@@ -269,14 +304,14 @@ func createModelScene() Scene {
 		scene.World.Add(triangle)
 	}
 
-	//newmod2 := model.NewModel("internal/model/mine.obj", "internal/model/mine.mtl")
+	//newmod2, err := model.LoadModel(rootCtx, "internal/model/mine.obj", "internal/model/mine.mtl")
 	//
 	//triangles = newmod2.ToTriangles(defaultMat, "minecraft_textures")
 	//for _, triangle := range triangles {
 	//	world.Add(triangle)
 	//}
 
-	//newmod3 := model.NewModel("internal/model/rauh.obj", "internal/model/rauh.mtl")
+	//newmod3, err := model.LoadModel(rootCtx, "internal/model/rauh.obj", "internal/model/rauh.mtl")
 	//
 	//triangles = newmod3.ToTriangles(defaultMat, "rauh_textures")
 	//for _, triangle := range triangles {
@@ -295,10 +330,10 @@ func createModelScene() Scene {
 	scene.Cam.LookAt = utils.Vec3{-2, 0, -1}
 	scene.Cam.Vup = utils.Vec3{Y: 1}
 
-	return scene
+	return scene, nil
 }
 
-func createQuadricScene() Scene {
+func createQuadricScene() (Scene, error) {
 	var scene Scene
 
 	scene.World.Add(objects.CreateQuadricSphere(
@@ -331,139 +366,331 @@ func createQuadricScene() Scene {
 	scene.Cam.LookAt = utils.Vec3{-2, 0, -1}
 	scene.Cam.Vup = utils.Vec3{Y: 1}
 
-	return scene
+	return scene, nil
 }
 
-func run() {
-	imageHeight := int(float64(cam.ImageWidth) / cam.AspectRatio)
-	if imageHeight < 0 {
-		imageHeight = 1
+func imageHeight() int {
+	return cam.ImageHeight()
+}
+
+// runHeadless renders a single frame without opening a window and writes it to outputFile
+func runHeadless() {
+	if allCubeFaces {
+		renderCubeFaces()
+		return
+	}
+	frame := renderFrame()
+	saveImage(outputFile, frame)
+	saveHeatmap(frame)
+}
+
+// renderCubeFaces renders the six faces into the directory outputFile names
+// without its extension, with the names and layout NewCubeMap loads, so
+// -o skybox bakes a skybox -cubemap skybox can use
+func renderCubeFaces() {
+	ext := filepath.Ext(outputFile)
+	dir := strings.TrimSuffix(outputFile, ext)
+	if ext == "" {
+		ext = ".jpg"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		panic(err)
 	}
+	for face, name := range utils.CubeFaceNames {
+		cam.CubeFace = face
+		fmt.Printf("Face %s\n", name)
+		saveImage(filepath.Join(dir, name+ext), renderFrame())
+		if rootCtx.Err() != nil {
+			return
+		}
+	}
+}
+
+// renderFrame renders the current camera once, denoised when asked for. With a
+// time budget it renders progressive passes until the budget runs out.
+func renderFrame() *utils.Framebuffer {
+	height := imageHeight()
+
+	var frame *utils.Framebuffer
+	if timeBudget > 0 {
+		// With a time budget render passes so stopping early still covers the whole image
+		acc := utils.NewAccumulator(cam.ImageWidth, height)
+		start := time.Now()
+		for acc.Passes < cam.SamplesPerPixel && time.Since(start) < timeBudget {
+			if cam.RenderPass(rootCtx, world, acc, utils.NullSink{}) != nil {
+				fmt.Println("Interrupted, saving the finished passes")
+				break
+			}
+		}
+		frame = acc.Image()
+		t = time.Since(start)
+		fmt.Printf("Rendered %d/%d passes\n", acc.Passes, cam.SamplesPerPixel)
+	} else {
+		result, err := cam.Render(rootCtx, world, utils.NullSink{})
+		if err != nil {
+			fmt.Printf("Interrupted, saving the %d/%d finished tiles\n", result.TilesDone, result.Tiles)
+		}
+		frame = result.Image
+		t = result.Duration
+	}
+
+	if cam.Denoiser != nil {
+		frame = cam.Denoiser.Denoise(frame)
+	}
+
+	fmt.Printf("Max image time: %v\n", t)
+	fmt.Printf("Image size: %d x %d\n", cam.ImageWidth, height)
+	return frame
+}
+
+// previewSink lets render goroutines write into the window's canvas while the
+// viewer loop stays the only one drawing it
+type previewSink struct {
+	*utils.DisplayBuffer
+}
+
+func (previewSink) Refresh() {}
+
+// renderView renders the current view into the preview until it is finished
+// or ctx is cancelled and returns what it got
+func renderView(ctx context.Context, sink utils.RenderSink, acc *utils.Accumulator) *utils.Framebuffer {
+	if !progressive {
+		result, err := cam.Render(ctx, world, sink)
+		if err != nil {
+			return result.Image
+		}
+		if result.Duration > t {
+			t = result.Duration
+		}
+		if cam.Denoiser == nil {
+			return result.Image
+		}
+		frame := cam.Denoiser.Denoise(result.Image)
+		utils.ShowFramebuffer(sink, frame, cam.ToneMap)
+		return frame
+	}
+
+	// With denoising only the filtered passes are shown, the raw ones would flicker in between
+	passSink := sink
+	if cam.Denoiser != nil {
+		passSink = utils.NullSink{}
+	}
+
+	// Keep refining until the target spp or the time budget is reached
+	start := time.Now()
+	for acc.Passes < cam.SamplesPerPixel && (timeBudget <= 0 || time.Since(start) < timeBudget) {
+		if cam.RenderPass(ctx, world, acc, passSink) != nil {
+			break
+		}
+		if cam.Denoiser != nil {
+			utils.ShowFramebuffer(sink, cam.Denoiser.Denoise(acc.Image()), cam.ToneMap)
+		}
+		t = time.Since(start)
+		fmt.Printf("\033[1A\033[K")
+		fmt.Printf("Pass %d/%d (%v)\n", acc.Passes, cam.SamplesPerPixel, t.Round(time.Millisecond))
+	}
+	if cam.Denoiser != nil {
+		return cam.Denoiser.Denoise(acc.Image())
+	}
+	return acc.Image()
+}
+
+func run() {
+	height := imageHeight()
 	// Create display buffer
-	display, err := utils.NewDisplayBuffer(cam.ImageWidth, imageHeight)
+	display, err := utils.NewDisplayBuffer(cam.ImageWidth, height)
 	if err != nil {
 		fmt.Println("Error creating display:", err)
 		return
 	}
 
-	pixels := make([]byte, imageHeight*cam.ImageWidth*3)
+	acc := utils.NewAccumulator(cam.ImageWidth, height)
+	var frame *utils.Framebuffer
+
+	// The render runs in the background so moving the camera can cancel it
+	// right away instead of waiting for the frame to finish
+	cancel := context.CancelFunc(func() {})
+	done := make(chan struct{})
+	close(done)
+	stopRender := func() {
+		cancel()
+		<-done
+	}
 
 	moveAmount := 0.5
-	for !display.Win.Closed() {
+	for !display.Win.Closed() && rootCtx.Err() == nil {
+		lookFrom, lookAt := cam.LookFrom, cam.LookAt
 		if display.Win.Pressed(pixel.KeyQ) {
-			cam.LookFrom.X += moveAmount
+			lookFrom.X += moveAmount
 			reRender = true
 		}
 		if display.Win.Pressed(pixel.KeyA) {
-			cam.LookFrom.X -= moveAmount
+			lookFrom.X -= moveAmount
 			reRender = true
 		}
 		if display.Win.Pressed(pixel.KeyW) {
-			cam.LookFrom.Y += moveAmount
+			lookFrom.Y += moveAmount
 			reRender = true
 		}
 		if display.Win.Pressed(pixel.KeyS) {
-			cam.LookFrom.Y -= moveAmount
+			lookFrom.Y -= moveAmount
 			reRender = true
 		}
 		if display.Win.Pressed(pixel.KeyE) {
-			cam.LookFrom.Z += moveAmount
+			lookFrom.Z += moveAmount
 			reRender = true
 		}
 		if display.Win.Pressed(pixel.KeyD) {
-			cam.LookFrom.Z -= moveAmount
+			lookFrom.Z -= moveAmount
 			reRender = true
 		}
 
 		if display.Win.Pressed(pixel.KeyU) {
-			cam.LookAt.X += moveAmount
+			lookAt.X += moveAmount
 			reRender = true
 		}
 		if display.Win.Pressed(pixel.KeyJ) {
-			cam.LookAt.X -= moveAmount
+			lookAt.X -= moveAmount
 			reRender = true
 		}
 		if display.Win.Pressed(pixel.KeyI) {
-			cam.LookAt.Y += moveAmount
+			lookAt.Y += moveAmount
 			reRender = true
 		}
 		if display.Win.Pressed(pixel.KeyK) {
-			cam.LookAt.Y -= moveAmount
+			lookAt.Y -= moveAmount
 			reRender = true
 		}
 		if display.Win.Pressed(pixel.KeyO) {
-			cam.LookAt.Z += moveAmount
+			lookAt.Z += moveAmount
 			reRender = true
 		}
 		if display.Win.Pressed(pixel.KeyL) {
-			cam.LookAt.Z -= moveAmount
+			lookAt.Z -= moveAmount
 			reRender = true
 		}
 
 		if reRender {
-			finishTime := cam.Render(world, display, pixels)
-			if finishTime > t {
-				t = finishTime
-			}
+			// The camera only changes once the old render has stopped using it
+			stopRender()
+			cam.LookFrom, cam.LookAt = lookFrom, lookAt
+			acc.Reset()
+
+			ctx, cancelRender := context.WithCancel(rootCtx)
+			cancel = cancelRender
+			done = make(chan struct{})
+			go func() {
+				defer close(done)
+				frame = renderView(ctx, previewSink{display}, acc)
+			}()
+
 			reRender = false
 			println("from:", cam.LookFrom.X, cam.LookFrom.Y, cam.LookFrom.Z)
 			println("at:", cam.LookAt.X, cam.LookAt.Y, cam.LookAt.Z)
 			println(" ")
 		}
-		display.Win.Update()
+
+		display.Refresh()
 	}
+	stopRender()
 
-	/*
-		todo: seems to write after the first worker finished instead of the last
-	*/
 	//fmt.Printf("\033[1A\033[K")
 	fmt.Printf("Max image time: %v\n", t)
-	fmt.Printf("Image size: %d x %d\n", cam.ImageWidth, imageHeight)
+	fmt.Printf("Image size: %d x %d\n", cam.ImageWidth, height)
 
-	saveToPNG(cam.ImageWidth, imageHeight, pixels)
-	return
-	if display.ShouldClose() {
-		//_, err = file.Write(pixels)
-		//if err != nil {
-		//	return
-		//}
+	saveImage(outputFile, frame)
+	saveHeatmap(frame)
+}
+func main() {
+	opts := parseOptions(os.Args[1:])
 
-		//fmt.Printf("\033[1A\033[K")
-		fmt.Printf("Max image time: %v\n", t)
-		fmt.Printf("Image size: %d x %d\n", cam.ImageWidth, imageHeight)
+	var stop context.CancelFunc
+	rootCtx, stop = signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-		saveToPNG(cam.ImageWidth, imageHeight, pixels)
-		//openFile("goimage.ppm")
-	}
+	outputFile = opts.output
+	heatmapFile = opts.heatmap
+	exrFloat = opts.exrFloat
+	progressive = opts.progressive
+	timeBudget = opts.timeBudget
 
-}
-func main() {
-	scene := CreateCornellBox()
+	var scene Scene
+	if opts.sceneFile != "" {
+		var err error
+		scene, err = LoadSceneFile(rootCtx, opts.sceneFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else {
+		var err error
+		scene, err = scenes[opts.scene].build()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if err := opts.apply(&scene.Cam); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if scene.Cam.Projection == utils.CubeFaceProjection && !opts.set["cube-face"] {
+		allCubeFaces = opts.headless
+		scene.Cam.CubeFace = utils.FRONT
+	}
 
 	fmt.Println("\n num of objects: ", len(scene.World.Objects))
 	fmt.Println(" ")
 
-	cubeMap, err := utils.NewCubeMap(
-		"internal/utils/cube_map_images/posx.jpg", // RIGHT
-		"internal/utils/cube_map_images/negx.jpg", // LEFT
-		"internal/utils/cube_map_images/posy.jpg", // TOP
-		"internal/utils/cube_map_images/negy.jpg", // BOTTOM
-		"internal/utils/cube_map_images/posz.jpg", // FRONT
-		"internal/utils/cube_map_images/negz.jpg", // BACK
-	)
-	if err != nil {
-		panic(err)
+	// Scene files may bring their own cube map, -cubemap still wins when given
+	if scene.CubeMap == nil || opts.set["cubemap"] {
+		cubeMap, err := utils.NewCubeMap(
+			filepath.Join(opts.cubeMapDir, "posx.jpg"), // RIGHT
+			filepath.Join(opts.cubeMapDir, "negx.jpg"), // LEFT
+			filepath.Join(opts.cubeMapDir, "posy.jpg"), // TOP
+			filepath.Join(opts.cubeMapDir, "negy.jpg"), // BOTTOM
+			filepath.Join(opts.cubeMapDir, "posz.jpg"), // FRONT
+			filepath.Join(opts.cubeMapDir, "negz.jpg"), // BACK
+		)
+		if err != nil {
+			panic(err)
+		}
+		scene.CubeMap = cubeMap
+	}
+
+	lights := objects.CollectLights(scene.World.Objects)
+	if slices.Contains(scene.Cam.AOVs, utils.AOVObjectID) {
+		scene.World.Objects = utils.TagObjects(scene.World.Objects)
 	}
-	scene.CubeMap = cubeMap
 
 	// Create BVH
-	bvhRoot := utils.NewBVHNode(scene.World.Objects, 0, len(scene.World.Objects))
+	var bvhRoot utils.Hittable
+	switch opts.bvh {
+	case "sah":
+		flat, err := utils.NewSAHBVH(rootCtx, scene.World.Objects)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "BVH build stopped:", err)
+			os.Exit(1)
+		}
+		fmt.Println("BVH:", flat.Stats())
+		bvhRoot = flat
+	case "median":
+		buildStart := time.Now()
+		bvhRoot = utils.NewBVHNode(scene.World.Objects, 0, len(scene.World.Objects))
+		fmt.Println("BVH: built in", time.Since(buildStart))
+	}
 	scene.World = utils.HittableList{Objects: []utils.Hittable{bvhRoot}}
 
 	world = scene.World
 	cam = scene.Cam
 	cam.Cube = *scene.CubeMap
 	cam.SkipCube = scene.SkipBackground
+	cam.Lights = lights
+
+	if opts.headless {
+		runHeadless()
+		return
+	}
 
 	reRender = true
 	opengl.Run(run)
@@ -487,25 +714,72 @@ func openFile(filename string) {
 		fmt.Println("Error opening file:", err)
 	}
 }
-func saveToPNG(width, height int, pixels []byte) {
-	// Create a new RGBA image
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-
-	// Fill the RGBA image with your pixel data
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			index := (y*width + x) * 3
-			r := pixels[index]
-			g := pixels[index+1]
-			b := pixels[index+2]
-
-			// Set pixel color in the RGBA image
-			img.Set(x, y, color.RGBA{R: r, G: g, B: b, A: 255})
+
+// saveImage writes the render in the format the file extension asks for:
+// linear OpenEXR or Radiance HDR, otherwise a tone mapped PNG. The camera's AOVs
+// are written along with it.
+func saveImage(filename string, frame *utils.Framebuffer) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".exr":
+		pixelType := utils.EXRHalf
+		if exrFloat {
+			pixelType = utils.EXRFloat
 		}
+		// AOVs become layers of the same file
+		channels := append(frame.Channels(pixelType), frame.AOVChannels(cam.AOVs, pixelType)...)
+		writeFile(filename, func(w io.Writer) error {
+			return utils.WriteEXR(w, frame.Width, frame.Height, channels)
+		})
+		return
+	case ".hdr":
+		writeFile(filename, func(w io.Writer) error {
+			return utils.WriteRGBE(w, frame)
+		})
+	case ".jpg", ".jpeg":
+		writeFile(filename, func(w io.Writer) error {
+			return jpeg.Encode(w, cam.ToneMap.Image(frame), &jpeg.Options{Quality: 95})
+		})
+	default:
+		saveToPNG(filename, frame)
+	}
+
+	// Other formats get a PNG preview per AOV next to the image, like render_albedo.png
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	for _, aov := range cam.AOVs {
+		writePNG(base+"_"+aov.String()+".png", frame.AOVPreview(aov))
+	}
+}
+
+func writeFile(filename string, write func(w io.Writer) error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		panic(err)
 	}
+	defer file.Close()
+
+	if err := write(file); err != nil {
+		panic(err)
+	}
+
+	println("Image saved as", filename)
+}
+
+// saveToPNG tone maps the HDR render to 8 bit and writes it
+func saveToPNG(filename string, frame *utils.Framebuffer) {
+	writePNG(filename, cam.ToneMap.Image(frame))
+}
+
+// saveHeatmap writes the samples per pixel of the render when -heatmap was given
+func saveHeatmap(frame *utils.Framebuffer) {
+	if heatmapFile == "" {
+		return
+	}
+	fmt.Printf("Average samples per pixel: %.1f\n", frame.AverageSamples())
+	writePNG(heatmapFile, utils.SampleHeatmap(frame, cam.SamplesPerPixel))
+}
 
-	// Save to PNG file
-	file, err := os.Create("output.png")
+func writePNG(filename string, img image.Image) {
+	file, err := os.Create(filename)
 	if err != nil {
 		panic(err)
 	}
@@ -516,5 +790,5 @@ func saveToPNG(width, height int, pixels []byte) {
 		panic(err)
 	}
 
-	println("PNG file saved as output.png")
+	println("PNG file saved as", filename)
 }
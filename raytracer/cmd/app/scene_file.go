@@ -0,0 +1,1177 @@
+package main
+
+/*
+Scene files are JSON documents loaded with -scene-file. Every section is optional
+except "objects". Colors and points are [x, y, z] arrays.
+
+	{
+	  "camera": {
+	    "aspect_ratio": 1.0, "image_width": 600, "samples_per_pixel": 200, "max_depth": 50,
+	    "vfov": 40, "look_from": [278, 278, -800], "look_at": [278, 278, 0], "vup": [0, 1, 0],
+	    "defocus_angle": 0, "focus_dist": 10, "seed": 0, "sampler": "sobol",
+	    "projection": "orthographic", "ortho_height": 600, "fisheye_fov": 180,
+	    "stereo": "side-by-side", "interocular_distance": 0.065, "convergence": 10,
+	    "physical": { "f_stop": 2.8, "focal_length": 50, "sensor_width": 36, "exposure_time": "1/60", "iso": 100, "units_per_meter": 1 },
+	    "aperture": { "blades": 6, "rotation": 0, "mask": "bokeh.png", "cat_eye": 0.5 },
+	    "shutter_open": 0, "shutter_close": 1, "shutter_curve": "box",
+	    "noise_threshold": 0.01, "min_samples": 16,
+	    "tonemap": "aces", "exposure": 0, "white_point": 4, "aovs": ["albedo", "normal", "depth"],
+	    "denoise": { "strength": 1, "iterations": 4 }, "filter": "mitchell", "filter_radius": 2
+	  },
+	  "background": { "cube_map": "internal/utils/cube_map_images" },   or { "skip": true }
+	  "textures": {
+	    "checks": { "type": "checker", "scale": 0.32, "even": [0.2, 0.3, 0.1], "odd": [0.9, 0.9, 0.9] },
+	    "earth":  { "type": "image", "file": "internal/model/earthmap.jpg" },
+	    "red":    { "type": "solid", "color": [0.65, 0.05, 0.05] }
+	  },
+	  "materials": {
+	    "white": { "type": "lambertian", "color": [0.73, 0.73, 0.73] },   or "texture": "checks"
+	    "steel": { "type": "metal", "color": [0.8, 0.8, 0.9], "fuzz": 0.1 },
+	    "glass": { "type": "dielectric", "refraction_index": 1.5 },
+	    "lamp":  { "type": "diffuse_light", "color": [15, 15, 15] },     or "texture"
+	    "fog":   { "type": "isotropic", "color": [1, 1, 1] }             or "texture"
+	  },
+	  "objects": [
+	    { "type": "sphere", "center": [0, 1, 0], "radius": 1, "material": "glass" },   optional "center2" moves it
+	    { "type": "quad", "q": [0, 0, 0], "u": [555, 0, 0], "v": [0, 0, 555], "material": "white" },
+	    { "type": "box", "min": [130, 0, 65], "max": [295, 165, 230], "material": "white" },
+	      any object can move with keyframes, scale defaults to [1, 1, 1] and rotations are in degrees:
+	      "motion": [{ "time": 0, "translate": [0, 0, 0], "rotate": [0, 0, 0], "scale": [1, 1, 1] }, { "time": 1, ... }]
+	    { "type": "triangle", "v0": [0, 0, 0], "v1": [1, 0, 0], "v2": [0, 1, 0], "material": "white" },
+	    { "type": "quadric", "shape": "cone", "center": [-2, 0, 0], "angle": 30, "material": "white" },
+	    { "type": "constant_medium", "density": 0.01, "color": [0, 0, 0], "boundary": { "type": "sphere", ... } },
+	      the boundary can be any closed shape, a box included
+	    { "type": "model", "obj": "internal/model/dakar.obj", "mtl": "internal/model/dakar.mtl",
+	      "textures": "dakar_textures", "material": "glass" }
+	  ]
+	}
+
+An "instance" takes the same fields as a model but loads each obj/mtl/textures/material
+combination only once and shares its BVH between instances. Its optional "override"
+names a material that replaces every material of the mesh for that instance:
+
+	{ "type": "instance", "obj": "tree.obj", "mtl": "tree.mtl", "material": "white",
+	  "override": "steel", "transform": [{ "translate": [4, 0, 0] }] }
+
+Any object can have a "transform", a list of steps applied in order:
+
+	"transform": [{ "scale": [2, 1, 1] }, { "rotate_y": 15 }, { "translate": [265, 0, 295] }]
+
+Steps are "translate", "scale", "rotate_x", "rotate_y", "rotate_z" (degrees) and
+"look_at": { "from": [...], "at": [...], "up": [0, 1, 0] } which turns the object's
++Z axis towards at and moves it to from.
+
+The physical camera's exposure_time only sets how bright the image is. How much motion
+blur there is comes from shutter_open and shutter_close, which are scene times and
+independent of it.
+
+Quadric shapes are "sphere" and "cylinder" (using radius) and "cone" (using angle in degrees).
+The material of a model is used for faces whose MTL material has no texture.
+*/
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/philippkk/coms336/raytracer/internal/model"
+	"github.com/philippkk/coms336/raytracer/internal/objects"
+	"github.com/philippkk/coms336/raytracer/internal/utils"
+	"github.com/philippkk/coms336/raytracer/internal/utils/material"
+)
+
+// SceneFileError points at the line and field of a scene file that failed to load
+type SceneFileError struct {
+	File  string
+	Line  int
+	Field string
+	Err   string
+}
+
+func (e *SceneFileError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", e.File, e.Line, e.Field, e.Err)
+}
+
+// vec3 is a JSON [x, y, z] array
+type vec3 [3]float64
+
+func (v *vec3) UnmarshalJSON(data []byte) error {
+	var values []float64
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("expected [x, y, z] but got %s", data)
+	}
+	if len(values) != 3 {
+		return fmt.Errorf("expected [x, y, z] but got %d components", len(values))
+	}
+	copy(v[:], values)
+	return nil
+}
+
+func (v *vec3) toVec3() utils.Vec3 {
+	return utils.Vec3{X: v[0], Y: v[1], Z: v[2]}
+}
+
+type cameraDef struct {
+	AspectRatio     *float64     `json:"aspect_ratio"`
+	ImageWidth      *int         `json:"image_width"`
+	SamplesPerPixel *int         `json:"samples_per_pixel"`
+	MaxDepth        *int         `json:"max_depth"`
+	Vfov            *float64     `json:"vfov"`
+	LookFrom        *vec3        `json:"look_from"`
+	LookAt          *vec3        `json:"look_at"`
+	Vup             *vec3        `json:"vup"`
+	DefocusAngle    *float64     `json:"defocus_angle"`
+	FocusDist       *float64     `json:"focus_dist"`
+	Seed            *uint64      `json:"seed"`
+	Sampler         string       `json:"sampler"`
+	NoiseThreshold  *float64     `json:"noise_threshold"`
+	MinSamples      *int         `json:"min_samples"`
+	ToneMap         string       `json:"tonemap"`
+	Exposure        *float64     `json:"exposure"`
+	WhitePoint      *float64     `json:"white_point"`
+	AOVs            []string     `json:"aovs"`
+	Denoise         *denoiseDef  `json:"denoise"`
+	Filter          string       `json:"filter"`
+	Projection      string       `json:"projection"`
+	OrthoHeight     *float64     `json:"ortho_height"`
+	FisheyeFOV      *float64     `json:"fisheye_fov"`
+	Stereo          string       `json:"stereo"`
+	Interocular     *float64     `json:"interocular_distance"`
+	Convergence     *float64     `json:"convergence"`
+	FilterRadius    *float64     `json:"filter_radius"`
+	Physical        *physicalDef `json:"physical"`
+	Aperture        *apertureDef `json:"aperture"`
+	ShutterOpen     *float64     `json:"shutter_open"`
+	ShutterClose    *float64     `json:"shutter_close"`
+	ShutterCurve    string       `json:"shutter_curve"`
+}
+
+// physicalDef turns the physical camera on, {} keeps every default
+type physicalDef struct {
+	FStop         float64      `json:"f_stop"`
+	FocalLength   float64      `json:"focal_length"`
+	SensorWidth   float64      `json:"sensor_width"`
+	ExposureTime  exposureTime `json:"exposure_time"`
+	ISO           float64      `json:"iso"`
+	UnitsPerMeter float64      `json:"units_per_meter"`
+}
+
+// exposureTime is an exposure time in seconds, given as a number or a string like "1/60"
+type exposureTime float64
+
+func (s *exposureTime) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*s = exposureTime(seconds)
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("expected seconds or a fraction like \"1/60\" but got %s", data)
+	}
+	seconds, err := parseExposureTime(text)
+	if err != nil {
+		return err
+	}
+	*s = exposureTime(seconds)
+	return nil
+}
+
+type apertureDef struct {
+	Blades   int     `json:"blades"`
+	Rotation float64 `json:"rotation"`
+	Mask     string  `json:"mask"`
+	CatEye   float64 `json:"cat_eye"`
+}
+
+// denoiseDef turns the denoiser on, {} keeps the default strength and iterations
+type denoiseDef struct {
+	Strength   float64 `json:"strength"`
+	Iterations int     `json:"iterations"`
+}
+
+type backgroundDef struct {
+	CubeMap string `json:"cube_map"`
+	Skip    bool   `json:"skip"`
+}
+
+type textureDef struct {
+	Type  string   `json:"type"`
+	Color *vec3    `json:"color"`
+	Scale *float64 `json:"scale"`
+	Even  *vec3    `json:"even"`
+	Odd   *vec3    `json:"odd"`
+	File  string   `json:"file"`
+}
+
+type materialDef struct {
+	Type            string   `json:"type"`
+	Color           *vec3    `json:"color"`
+	Texture         string   `json:"texture"`
+	Fuzz            float64  `json:"fuzz"`
+	RefractionIndex *float64 `json:"refraction_index"`
+}
+
+type objectDef struct {
+	Type     string `json:"type"`
+	Material string `json:"material"`
+
+	Center  *vec3    `json:"center"`
+	Center2 *vec3    `json:"center2"`
+	Radius  *float64 `json:"radius"`
+
+	Q *vec3 `json:"q"`
+	U *vec3 `json:"u"`
+	V *vec3 `json:"v"`
+
+	Min *vec3 `json:"min"`
+	Max *vec3 `json:"max"`
+
+	V0 *vec3 `json:"v0"`
+	V1 *vec3 `json:"v1"`
+	V2 *vec3 `json:"v2"`
+
+	Shape string   `json:"shape"`
+	Angle *float64 `json:"angle"`
+
+	Boundary *objectDef `json:"boundary"`
+	Density  *float64   `json:"density"`
+	Color    *vec3      `json:"color"`
+
+	Obj      string `json:"obj"`
+	Mtl      string `json:"mtl"`
+	Textures string `json:"textures"`
+	Override string `json:"override"`
+
+	Transform []transformDef `json:"transform"`
+	Motion    []keyframeDef  `json:"motion"`
+}
+
+// keyframeDef is one pose of a moving object, it stays put before the first and after the last
+type keyframeDef struct {
+	Time      *float64 `json:"time"`
+	Translate *vec3    `json:"translate"`
+	Rotate    *vec3    `json:"rotate"`
+	Scale     *vec3    `json:"scale"`
+}
+
+// transformDef is one step of an object's transform, exactly one field is set
+type transformDef struct {
+	Translate *vec3      `json:"translate"`
+	Scale     *vec3      `json:"scale"`
+	RotateX   *float64   `json:"rotate_x"`
+	RotateY   *float64   `json:"rotate_y"`
+	RotateZ   *float64   `json:"rotate_z"`
+	LookAt    *lookAtDef `json:"look_at"`
+}
+
+type lookAtDef struct {
+	From *vec3 `json:"from"`
+	At   *vec3 `json:"at"`
+	Up   *vec3 `json:"up"`
+}
+
+// sceneLoader keeps the raw file around so errors can be turned into line numbers
+type sceneLoader struct {
+	ctx       context.Context
+	file      string
+	data      []byte
+	textures  map[string]utils.Texture
+	materials map[string]utils.Material
+	meshes    map[meshKey]*utils.FlatBVH
+}
+
+// meshKey identifies a loaded model, instances with equal keys share one BVH
+type meshKey struct {
+	obj, mtl, textures, material string
+}
+
+// LoadSceneFile parses and validates a scene file, see the format description above.
+// Cancelling ctx stops model loading and BVH builds and returns ctx.Err().
+func LoadSceneFile(ctx context.Context, filename string) (Scene, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Scene{}, err
+	}
+
+	l := &sceneLoader{
+		ctx:       ctx,
+		file:      filename,
+		data:      data,
+		textures:  map[string]utils.Texture{},
+		materials: map[string]utils.Material{},
+		meshes:    map[meshKey]*utils.FlatBVH{},
+	}
+	return l.load()
+}
+
+func (l *sceneLoader) errorAt(offset int64, field, format string, args ...any) error {
+	return &SceneFileError{File: l.file, Line: l.lineAt(offset), Field: field, Err: fmt.Sprintf(format, args...)}
+}
+
+// lineAt returns the line of the first value at or after offset
+func (l *sceneLoader) lineAt(offset int64) int {
+	if offset > int64(len(l.data)) {
+		offset = int64(len(l.data))
+	}
+	for offset < int64(len(l.data)) {
+		c := l.data[offset]
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' && c != ',' && c != ':' {
+			break
+		}
+		offset++
+	}
+	return bytes.Count(l.data[:offset], []byte("\n")) + 1
+}
+
+// decodeError converts errors from encoding/json into SceneFileErrors
+func (l *sceneLoader) decodeError(err error, start int64, field string) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return l.errorAt(syntaxErr.Offset, field, "%v", syntaxErr)
+	case errors.As(err, &typeErr):
+		if typeErr.Field != "" {
+			field += "." + typeErr.Field
+		}
+		return l.errorAt(start+typeErr.Offset, field, "expected %v but got %s", typeErr.Type, typeErr.Value)
+	}
+	return l.errorAt(start, field, "%v", err)
+}
+
+// decodeValue strictly decodes the next value from dec into v
+func (l *sceneLoader) decodeValue(dec *json.Decoder, field string, v any) (int64, error) {
+	var raw json.RawMessage
+	start := dec.InputOffset()
+	if err := dec.Decode(&raw); err != nil {
+		return start, l.decodeError(err, start, field)
+	}
+
+	// Skip the separator and whitespace so offsets inside raw line up with the file
+	for start < int64(len(l.data)) && bytes.IndexByte([]byte(" \t\r\n,:"), l.data[start]) >= 0 {
+		start++
+	}
+
+	inner := json.NewDecoder(bytes.NewReader(raw))
+	inner.DisallowUnknownFields()
+	if err := inner.Decode(v); err != nil {
+		return start, l.decodeError(err, start, field)
+	}
+	return start, nil
+}
+
+func (l *sceneLoader) expectDelim(dec *json.Decoder, field string, delim json.Delim) error {
+	offset := dec.InputOffset()
+	tok, err := dec.Token()
+	if err != nil {
+		return l.decodeError(err, offset, field)
+	}
+	if tok != delim {
+		return l.errorAt(offset, field, "expected %v", delim)
+	}
+	return nil
+}
+
+// eachEntry walks a {"name": value, ...} object calling fn with the offset of each value
+func (l *sceneLoader) eachEntry(dec *json.Decoder, field string, fn func(name string, dec *json.Decoder) error) error {
+	if err := l.expectDelim(dec, field, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return l.decodeError(err, offset, field)
+		}
+		if err := fn(tok.(string), dec); err != nil {
+			return err
+		}
+	}
+	return l.expectDelim(dec, field, '}')
+}
+
+func (l *sceneLoader) load() (Scene, error) {
+	var scene Scene
+	scene.Cam = createDefaultCam()
+	scene.Cam.Vup = utils.Vec3{Y: 1}
+
+	// Objects can reference materials defined further down, so build them last
+	type pendingObject struct {
+		def    objectDef
+		offset int64
+		field  string
+	}
+	var pending []pendingObject
+	var sawObjects bool
+
+	dec := json.NewDecoder(bytes.NewReader(l.data))
+	err := l.eachEntry(dec, "scene", func(key string, dec *json.Decoder) error {
+		switch key {
+		case "camera":
+			var def cameraDef
+			offset, err := l.decodeValue(dec, "camera", &def)
+			if err != nil {
+				return err
+			}
+			return l.applyCamera(&scene.Cam, def, offset)
+		case "background":
+			var def backgroundDef
+			offset, err := l.decodeValue(dec, "background", &def)
+			if err != nil {
+				return err
+			}
+			scene.SkipBackground = def.Skip
+			if def.CubeMap != "" {
+				dir := def.CubeMap
+				scene.CubeMap, err = utils.NewCubeMap(
+					filepath.Join(dir, "posx.jpg"),
+					filepath.Join(dir, "negx.jpg"),
+					filepath.Join(dir, "posy.jpg"),
+					filepath.Join(dir, "negy.jpg"),
+					filepath.Join(dir, "posz.jpg"),
+					filepath.Join(dir, "negz.jpg"),
+				)
+				if err != nil {
+					return l.errorAt(offset, "background.cube_map", "%v", err)
+				}
+			}
+			return nil
+		case "textures":
+			return l.eachEntry(dec, "textures", func(name string, dec *json.Decoder) error {
+				field := "textures." + name
+				var def textureDef
+				offset, err := l.decodeValue(dec, field, &def)
+				if err != nil {
+					return err
+				}
+				tex, err := l.buildTexture(def, offset, field)
+				if err != nil {
+					return err
+				}
+				l.textures[name] = tex
+				return nil
+			})
+		case "materials":
+			return l.eachEntry(dec, "materials", func(name string, dec *json.Decoder) error {
+				field := "materials." + name
+				var def materialDef
+				offset, err := l.decodeValue(dec, field, &def)
+				if err != nil {
+					return err
+				}
+				mat, err := l.buildMaterial(def, offset, field)
+				if err != nil {
+					return err
+				}
+				l.materials[name] = mat
+				return nil
+			})
+		case "objects":
+			sawObjects = true
+			if err := l.expectDelim(dec, "objects", '['); err != nil {
+				return err
+			}
+			for i := 0; dec.More(); i++ {
+				field := fmt.Sprintf("objects[%d]", i)
+				var def objectDef
+				offset, err := l.decodeValue(dec, field, &def)
+				if err != nil {
+					return err
+				}
+				pending = append(pending, pendingObject{def, offset, field})
+			}
+			return l.expectDelim(dec, "objects", ']')
+		default:
+			return l.errorAt(dec.InputOffset(), key, "unknown section")
+		}
+	})
+	if err != nil {
+		return Scene{}, err
+	}
+	if !sawObjects {
+		return Scene{}, &SceneFileError{File: l.file, Line: 1, Field: "objects", Err: "missing"}
+	}
+
+	for _, obj := range pending {
+		objs, err := l.buildObject(obj.def, obj.offset, obj.field)
+		if err != nil {
+			return Scene{}, err
+		}
+		for _, o := range objs {
+			scene.World.Add(o)
+		}
+	}
+	return scene, nil
+}
+
+// checkCamera holds a camera setting to its rule in cameraChecks
+func (l *sceneLoader) checkCamera(offset int64, setting string, v float64) error {
+	if err := cameraChecks[setting](v); err != nil {
+		return l.errorAt(offset, "camera."+setting, "%v", err)
+	}
+	return nil
+}
+
+func (l *sceneLoader) applyCamera(c *utils.Camera, def cameraDef, offset int64) error {
+	if def.AspectRatio != nil {
+		if err := l.checkCamera(offset, "aspect_ratio", *def.AspectRatio); err != nil {
+			return err
+		}
+		c.AspectRatio = *def.AspectRatio
+	}
+	if def.ImageWidth != nil {
+		if err := l.checkCamera(offset, "image_width", float64(*def.ImageWidth)); err != nil {
+			return err
+		}
+		c.ImageWidth = *def.ImageWidth
+	}
+	if def.SamplesPerPixel != nil {
+		if err := l.checkCamera(offset, "samples_per_pixel", float64(*def.SamplesPerPixel)); err != nil {
+			return err
+		}
+		c.SamplesPerPixel = *def.SamplesPerPixel
+	}
+	if def.MaxDepth != nil {
+		if err := l.checkCamera(offset, "max_depth", float64(*def.MaxDepth)); err != nil {
+			return err
+		}
+		c.MaxDepth = *def.MaxDepth
+	}
+	if def.Vfov != nil {
+		if err := l.checkCamera(offset, "vfov", *def.Vfov); err != nil {
+			return err
+		}
+		c.Vfov = *def.Vfov
+	}
+	if def.LookFrom != nil {
+		c.LookFrom = def.LookFrom.toVec3()
+	}
+	if def.LookAt != nil {
+		c.LookAt = def.LookAt.toVec3()
+	}
+	if def.Vup != nil {
+		c.Vup = def.Vup.toVec3()
+	}
+	if def.DefocusAngle != nil {
+		c.DefocusAngle = *def.DefocusAngle
+	}
+	if def.FocusDist != nil {
+		c.Focusdist = *def.FocusDist
+	}
+	if def.Seed != nil {
+		c.Seed = *def.Seed
+	}
+	if def.NoiseThreshold != nil {
+		if err := l.checkCamera(offset, "noise_threshold", *def.NoiseThreshold); err != nil {
+			return err
+		}
+		c.NoiseThreshold = *def.NoiseThreshold
+	}
+	if def.MinSamples != nil {
+		if err := l.checkCamera(offset, "min_samples", float64(*def.MinSamples)); err != nil {
+			return err
+		}
+		c.MinSamples = *def.MinSamples
+	}
+	if def.Sampler != "" {
+		sampler, err := utils.ParseSamplerType(def.Sampler)
+		if err != nil {
+			return l.errorAt(offset, "camera.sampler", "%v", err)
+		}
+		c.Sampler = sampler
+	}
+	if def.ToneMap != "" {
+		toneMap, err := utils.ParseToneMapOperator(def.ToneMap)
+		if err != nil {
+			return l.errorAt(offset, "camera.tonemap", "%v", err)
+		}
+		c.ToneMap.Operator = toneMap
+	}
+	if def.Exposure != nil {
+		c.ToneMap.Exposure = *def.Exposure
+	}
+	if def.WhitePoint != nil {
+		if err := l.checkCamera(offset, "white_point", *def.WhitePoint); err != nil {
+			return err
+		}
+		c.ToneMap.WhitePoint = *def.WhitePoint
+	}
+	if def.AOVs != nil {
+		c.AOVs = nil
+		for _, name := range def.AOVs {
+			aov, err := utils.ParseAOV(name)
+			if err != nil {
+				return l.errorAt(offset, "camera.aovs", "%v", err)
+			}
+			if !slices.Contains(c.AOVs, aov) {
+				c.AOVs = append(c.AOVs, aov)
+			}
+		}
+	}
+	if def.Projection != "" {
+		projection, err := utils.ParseProjection(def.Projection)
+		if err != nil {
+			return l.errorAt(offset, "camera.projection", "%v", err)
+		}
+		c.Projection = projection
+	}
+	if def.OrthoHeight != nil {
+		if err := l.checkCamera(offset, "ortho_height", *def.OrthoHeight); err != nil {
+			return err
+		}
+		c.OrthoHeight = *def.OrthoHeight
+	}
+	if def.FisheyeFOV != nil {
+		if err := l.checkCamera(offset, "fisheye_fov", *def.FisheyeFOV); err != nil {
+			return err
+		}
+		c.FisheyeFOV = *def.FisheyeFOV
+	}
+	if def.Stereo != "" {
+		stereo, err := utils.ParseStereoMode(def.Stereo)
+		if err != nil {
+			return l.errorAt(offset, "camera.stereo", "%v", err)
+		}
+		c.Stereo = stereo
+	}
+	if def.Interocular != nil {
+		if err := l.checkCamera(offset, "interocular_distance", *def.Interocular); err != nil {
+			return err
+		}
+		c.InterocularDistance = *def.Interocular
+	}
+	if def.Convergence != nil {
+		if err := l.checkCamera(offset, "convergence", *def.Convergence); err != nil {
+			return err
+		}
+		c.Convergence = *def.Convergence
+	}
+	if def.Filter != "" {
+		filter, err := utils.ParseFilterType(def.Filter)
+		if err != nil {
+			return l.errorAt(offset, "camera.filter", "%v", err)
+		}
+		c.Filter.Type = filter
+	}
+	if def.FilterRadius != nil {
+		if err := l.checkCamera(offset, "filter_radius", *def.FilterRadius); err != nil {
+			return err
+		}
+		c.Filter.Radius = *def.FilterRadius
+	}
+	if err := checkFilter(c.Filter); err != nil {
+		return l.errorAt(offset, "camera.filter_radius", "%v", err)
+	}
+	if def.Denoise != nil {
+		if err := l.checkCamera(offset, "denoise.strength", def.Denoise.Strength); err != nil {
+			return err
+		}
+		if err := l.checkCamera(offset, "denoise.iterations", float64(def.Denoise.Iterations)); err != nil {
+			return err
+		}
+		c.Denoiser = &utils.Denoiser{Strength: def.Denoise.Strength, Iterations: def.Denoise.Iterations}
+	}
+	if p := def.Physical; p != nil {
+		for _, v := range []struct {
+			name  string
+			value float64
+		}{
+			{"f_stop", p.FStop}, {"focal_length", p.FocalLength}, {"sensor_width", p.SensorWidth},
+			{"exposure_time", float64(p.ExposureTime)}, {"iso", p.ISO}, {"units_per_meter", p.UnitsPerMeter},
+		} {
+			if err := l.checkCamera(offset, "physical."+v.name, v.value); err != nil {
+				return err
+			}
+		}
+		c.Physical = &utils.PhysicalCamera{
+			FStop:         p.FStop,
+			FocalLength:   p.FocalLength,
+			SensorWidth:   p.SensorWidth,
+			ExposureTime:  float64(p.ExposureTime),
+			ISO:           p.ISO,
+			UnitsPerMeter: p.UnitsPerMeter,
+		}
+	}
+	if def.ShutterOpen != nil || def.ShutterClose != nil {
+		if c.ShutterOpen == 0 && c.ShutterClose == 0 {
+			c.ShutterClose = 1
+		}
+		if def.ShutterOpen != nil {
+			c.ShutterOpen = *def.ShutterOpen
+		}
+		if def.ShutterClose != nil {
+			c.ShutterClose = *def.ShutterClose
+		}
+		if err := checkShutter(c); err != nil {
+			return l.errorAt(offset, "camera.shutter_close", "%v", err)
+		}
+	}
+	if def.ShutterCurve != "" {
+		curve, err := utils.ParseShutterCurve(def.ShutterCurve)
+		if err != nil {
+			return l.errorAt(offset, "camera.shutter_curve", "%v", err)
+		}
+		c.ShutterCurve = curve
+	}
+	if a := def.Aperture; a != nil {
+		if err := l.checkCamera(offset, "aperture.blades", float64(a.Blades)); err != nil {
+			return err
+		}
+		if err := l.checkCamera(offset, "aperture.cat_eye", a.CatEye); err != nil {
+			return err
+		}
+		c.Aperture = utils.Aperture{Blades: a.Blades, Rotation: a.Rotation, CatEye: a.CatEye}
+		if a.Mask != "" {
+			mask, err := utils.NewApertureMask(a.Mask)
+			if err != nil {
+				return l.errorAt(offset, "camera.aperture.mask", "%v", err)
+			}
+			c.Aperture.Mask = mask
+		}
+	}
+	if c.LookFrom == c.LookAt {
+		return l.errorAt(offset, "camera.look_at", "must differ from look_from")
+	}
+	if err := checkStereo(c); err != nil {
+		return l.errorAt(offset, "camera.stereo", "%v", err)
+	}
+	return nil
+}
+
+func (l *sceneLoader) buildTexture(def textureDef, offset int64, field string) (utils.Texture, error) {
+	switch def.Type {
+	case "solid":
+		if def.Color == nil {
+			return nil, l.errorAt(offset, field+".color", "required for solid textures")
+		}
+		return utils.NewSolidColor(def.Color.toVec3()), nil
+	case "checker":
+		if def.Scale == nil || *def.Scale <= 0 {
+			return nil, l.errorAt(offset, field+".scale", "must be positive")
+		}
+		if def.Even == nil {
+			return nil, l.errorAt(offset, field+".even", "required for checker textures")
+		}
+		if def.Odd == nil {
+			return nil, l.errorAt(offset, field+".odd", "required for checker textures")
+		}
+		return utils.NewCheckerTextureFromColors(*def.Scale, def.Even.toVec3(), def.Odd.toVec3()), nil
+	case "image":
+		if def.File == "" {
+			return nil, l.errorAt(offset, field+".file", "required for image textures")
+		}
+		tex, err := utils.NewImageTexture(def.File)
+		if err != nil {
+			return nil, l.errorAt(offset, field+".file", "%v", err)
+		}
+		return tex, nil
+	case "":
+		return nil, l.errorAt(offset, field+".type", "missing")
+	}
+	return nil, l.errorAt(offset, field+".type", "unknown texture type %q", def.Type)
+}
+
+// textureOrColor resolves the "texture" or "color" field of a material
+func (l *sceneLoader) textureOrColor(def materialDef, offset int64, field string) (utils.Texture, error) {
+	if def.Texture != "" {
+		tex, ok := l.textures[def.Texture]
+		if !ok {
+			return nil, l.errorAt(offset, field+".texture", "unknown texture %q", def.Texture)
+		}
+		return tex, nil
+	}
+	if def.Color == nil {
+		return nil, l.errorAt(offset, field, "needs a color or texture")
+	}
+	return utils.NewSolidColor(def.Color.toVec3()), nil
+}
+
+func (l *sceneLoader) buildMaterial(def materialDef, offset int64, field string) (utils.Material, error) {
+	switch def.Type {
+	case "lambertian":
+		tex, err := l.textureOrColor(def, offset, field)
+		if err != nil {
+			return nil, err
+		}
+		return material.NewLambertian(tex), nil
+	case "metal":
+		if def.Color == nil {
+			return nil, l.errorAt(offset, field+".color", "required for metal")
+		}
+		if def.Fuzz < 0 || def.Fuzz > 1 {
+			return nil, l.errorAt(offset, field+".fuzz", "must be between 0 and 1")
+		}
+		return material.Metal{Albedo: def.Color.toVec3(), Fuzz: def.Fuzz}, nil
+	case "dielectric":
+		if def.RefractionIndex == nil || *def.RefractionIndex <= 0 {
+			return nil, l.errorAt(offset, field+".refraction_index", "must be positive")
+		}
+		return material.Dielectric{RefractionIndex: *def.RefractionIndex}, nil
+	case "diffuse_light":
+		tex, err := l.textureOrColor(def, offset, field)
+		if err != nil {
+			return nil, err
+		}
+		return material.NewDiffuseLightFromTexture(tex), nil
+	case "isotropic":
+		tex, err := l.textureOrColor(def, offset, field)
+		if err != nil {
+			return nil, err
+		}
+		return material.NewIsotropicFromTexture(tex), nil
+	case "":
+		return nil, l.errorAt(offset, field+".type", "missing")
+	}
+	return nil, l.errorAt(offset, field+".type", "unknown material type %q", def.Type)
+}
+
+func (l *sceneLoader) lookupMaterial(name string, offset int64, field string) (utils.Material, error) {
+	if name == "" {
+		return nil, l.errorAt(offset, field+".material", "missing")
+	}
+	mat, ok := l.materials[name]
+	if !ok {
+		return nil, l.errorAt(offset, field+".material", "unknown material %q", name)
+	}
+	return mat, nil
+}
+
+// buildObject returns a slice since boxes and models expand into several primitives,
+// a transformed object is always a single instance
+func (l *sceneLoader) buildObject(def objectDef, offset int64, field string) ([]utils.Hittable, error) {
+	objects, err := l.buildStaticObject(def, offset, field)
+	if err != nil || len(def.Motion) == 0 {
+		return objects, err
+	}
+	keyframes, err := l.buildKeyframes(def.Motion, offset, field+".motion")
+	if err != nil {
+		return nil, err
+	}
+
+	var object utils.Hittable
+	if len(objects) == 1 {
+		object = objects[0]
+	} else {
+		if object, err = utils.NewSAHBVH(l.ctx, objects); err != nil {
+			return nil, err
+		}
+	}
+	motion, err := utils.NewMotion(object, keyframes...)
+	if err != nil {
+		return nil, l.errorAt(offset, field+".motion", "%v", err)
+	}
+	return []utils.Hittable{motion}, nil
+}
+
+func (l *sceneLoader) buildKeyframes(defs []keyframeDef, offset int64, field string) ([]utils.Keyframe, error) {
+	keyframes := make([]utils.Keyframe, len(defs))
+	for i, def := range defs {
+		keyField := fmt.Sprintf("%s[%d]", field, i)
+		if def.Time == nil {
+			return nil, l.errorAt(offset, keyField+".time", "required")
+		}
+		k := utils.Keyframe{Time: *def.Time, Scale: utils.Vec3{X: 1, Y: 1, Z: 1}}
+		if def.Translate != nil {
+			k.Translate = def.Translate.toVec3()
+		}
+		if def.Rotate != nil {
+			k.Rotate = def.Rotate.toVec3()
+		}
+		if def.Scale != nil {
+			if def.Scale[0] == 0 || def.Scale[1] == 0 || def.Scale[2] == 0 {
+				return nil, l.errorAt(offset, keyField+".scale", "must not be zero")
+			}
+			k.Scale = def.Scale.toVec3()
+		}
+		keyframes[i] = k
+	}
+	return keyframes, nil
+}
+
+// buildStaticObject is the object before its motion
+func (l *sceneLoader) buildStaticObject(def objectDef, offset int64, field string) ([]utils.Hittable, error) {
+	if def.Type == "instance" {
+		instance, err := l.buildInstance(def, offset, field)
+		if err != nil {
+			return nil, err
+		}
+		return []utils.Hittable{instance}, nil
+	}
+
+	prims, err := l.buildPrimitives(def, offset, field)
+	if err != nil || len(def.Transform) == 0 {
+		return prims, err
+	}
+	m, err := l.buildTransform(def.Transform, offset, field+".transform")
+	if err != nil {
+		return nil, err
+	}
+
+	var object utils.Hittable
+	if len(prims) == 1 {
+		object = prims[0]
+	} else {
+		if object, err = utils.NewSAHBVH(l.ctx, prims); err != nil {
+			return nil, err
+		}
+	}
+	t, err := utils.NewTransform(object, m)
+	if err != nil {
+		return nil, l.errorAt(offset, field+".transform", "%v", err)
+	}
+	return []utils.Hittable{t}, nil
+}
+
+// buildTransform composes the steps so the first one is applied first
+func (l *sceneLoader) buildTransform(steps []transformDef, offset int64, field string) (utils.Mat4, error) {
+	m := utils.Identity()
+	for i, step := range steps {
+		stepField := fmt.Sprintf("%s[%d]", field, i)
+		var next utils.Mat4
+		set := 0
+		if step.Translate != nil {
+			next = utils.Translation(step.Translate.toVec3())
+			set++
+		}
+		if step.Scale != nil {
+			if step.Scale[0] == 0 || step.Scale[1] == 0 || step.Scale[2] == 0 {
+				return m, l.errorAt(offset, stepField+".scale", "must not be zero")
+			}
+			next = utils.Scaling(step.Scale.toVec3())
+			set++
+		}
+		if step.RotateX != nil {
+			next = utils.RotationX(*step.RotateX)
+			set++
+		}
+		if step.RotateY != nil {
+			next = utils.RotationY(*step.RotateY)
+			set++
+		}
+		if step.RotateZ != nil {
+			next = utils.RotationZ(*step.RotateZ)
+			set++
+		}
+		if step.LookAt != nil {
+			if step.LookAt.From == nil || step.LookAt.At == nil {
+				return m, l.errorAt(offset, stepField+".look_at", "needs from and at")
+			}
+			up := utils.Vec3{X: 0, Y: 1, Z: 0}
+			if step.LookAt.Up != nil {
+				up = step.LookAt.Up.toVec3()
+			}
+			from, at := step.LookAt.From.toVec3(), step.LookAt.At.toVec3()
+			if from == at || at.MinusEq(from).Cross(up).NearZero() {
+				return m, l.errorAt(offset, stepField+".look_at", "at must differ from from and not lie along up")
+			}
+			next = utils.LookAtMatrix(from, at, up)
+			set++
+		}
+		if set != 1 {
+			return m, l.errorAt(offset, stepField, "expected exactly one of translate, scale, rotate_x, rotate_y, rotate_z or look_at")
+		}
+		m = next.Mul(m)
+	}
+	return m, nil
+}
+
+// buildInstance loads a model once per obj/mtl/textures/material and places it again
+// for every further instance
+func (l *sceneLoader) buildInstance(def objectDef, offset int64, field string) (*utils.Instance, error) {
+	mat, err := l.lookupMaterial(def.Material, offset, field)
+	if err != nil {
+		return nil, err
+	}
+	if def.Obj == "" {
+		return nil, l.errorAt(offset, field+".obj", "required for instance")
+	}
+	if def.Mtl == "" {
+		return nil, l.errorAt(offset, field+".mtl", "required for instance")
+	}
+	var override utils.Material
+	var ok bool
+	if def.Override != "" {
+		if override, ok = l.materials[def.Override]; !ok {
+			return nil, l.errorAt(offset, field+".override", "unknown material %q", def.Override)
+		}
+	}
+	m, err := l.buildTransform(def.Transform, offset, field+".transform")
+	if err != nil {
+		return nil, err
+	}
+
+	key := meshKey{def.Obj, def.Mtl, def.Textures, def.Material}
+	mesh, ok := l.meshes[key]
+	if !ok {
+		for name, path := range map[string]string{"obj": def.Obj, "mtl": def.Mtl} {
+			if _, err := os.Stat(path); err != nil {
+				return nil, l.errorAt(offset, field+"."+name, "%v", err)
+			}
+		}
+		m, err := l.loadModel(def, offset, field)
+		if err != nil {
+			return nil, err
+		}
+		if mesh, err = m.ToMesh(l.ctx, mat, def.Textures); err != nil {
+			return nil, err
+		}
+		l.meshes[key] = mesh
+	}
+	instance, err := utils.NewInstance(mesh, m, override)
+	if err != nil {
+		return nil, l.errorAt(offset, field+".transform", "%v", err)
+	}
+	return instance, nil
+}
+
+// loadModel reads the obj and mtl files of def, cancellation is passed through as is
+func (l *sceneLoader) loadModel(def objectDef, offset int64, field string) (model.Model, error) {
+	m, err := model.LoadModel(l.ctx, def.Obj, def.Mtl)
+	if err != nil {
+		if l.ctx.Err() != nil {
+			return model.Model{}, err
+		}
+		return model.Model{}, l.errorAt(offset, field+".obj", "%v", err)
+	}
+	return m, nil
+}
+
+func (l *sceneLoader) buildPrimitives(def objectDef, offset int64, field string) ([]utils.Hittable, error) {
+	require := func(name string, present bool) error {
+		if !present {
+			return l.errorAt(offset, field+"."+name, "required for %s", def.Type)
+		}
+		return nil
+	}
+
+	switch def.Type {
+	case "sphere":
+		mat, err := l.lookupMaterial(def.Material, offset, field)
+		if err != nil {
+			return nil, err
+		}
+		if err := errors.Join(require("center", def.Center != nil), require("radius", def.Radius != nil)); err != nil {
+			return nil, err
+		}
+		center := utils.Ray{Origin: def.Center.toVec3()}
+		if def.Center2 != nil {
+			center.Direction = def.Center2.toVec3().MinusEq(center.Origin)
+		}
+		return []utils.Hittable{objects.CreateSphere(center, *def.Radius, mat)}, nil
+	case "quad":
+		mat, err := l.lookupMaterial(def.Material, offset, field)
+		if err != nil {
+			return nil, err
+		}
+		if err := errors.Join(require("q", def.Q != nil), require("u", def.U != nil), require("v", def.V != nil)); err != nil {
+			return nil, err
+		}
+		if def.U.toVec3().Cross(def.V.toVec3()).NearZero() {
+			return nil, l.errorAt(offset, field+".v", "u and v must not be parallel")
+		}
+		return []utils.Hittable{objects.CreateQuad(def.Q.toVec3(), def.U.toVec3(), def.V.toVec3(), mat)}, nil
+	case "box":
+		mat, err := l.lookupMaterial(def.Material, offset, field)
+		if err != nil {
+			return nil, err
+		}
+		if err := errors.Join(require("min", def.Min != nil), require("max", def.Max != nil)); err != nil {
+			return nil, err
+		}
+		return objects.CreateBox(def.Min.toVec3(), def.Max.toVec3(), mat), nil
+	case "triangle":
+		mat, err := l.lookupMaterial(def.Material, offset, field)
+		if err != nil {
+			return nil, err
+		}
+		if err := errors.Join(require("v0", def.V0 != nil), require("v1", def.V1 != nil), require("v2", def.V2 != nil)); err != nil {
+			return nil, err
+		}
+		return []utils.Hittable{objects.CreateTriangle(def.V0.toVec3(), def.V1.toVec3(), def.V2.toVec3(), mat)}, nil
+	case "quadric":
+		mat, err := l.lookupMaterial(def.Material, offset, field)
+		if err != nil {
+			return nil, err
+		}
+		if err := require("center", def.Center != nil); err != nil {
+			return nil, err
+		}
+		switch def.Shape {
+		case "sphere":
+			if err := require("radius", def.Radius != nil); err != nil {
+				return nil, err
+			}
+			return []utils.Hittable{objects.CreateQuadricSphere(def.Center.toVec3(), *def.Radius, mat)}, nil
+		case "cylinder":
+			if err := require("radius", def.Radius != nil); err != nil {
+				return nil, err
+			}
+			return []utils.Hittable{objects.CreateCylinder(def.Center.toVec3(), *def.Radius, mat)}, nil
+		case "cone":
+			if err := require("angle", def.Angle != nil); err != nil {
+				return nil, err
+			}
+			return []utils.Hittable{objects.CreateCone(def.Center.toVec3(), *def.Angle*math.Pi/180, mat)}, nil
+		}
+		return nil, l.errorAt(offset, field+".shape", "expected sphere, cylinder or cone but got %q", def.Shape)
+	case "constant_medium":
+		if err := errors.Join(require("boundary", def.Boundary != nil), require("density", def.Density != nil), require("color", def.Color != nil)); err != nil {
+			return nil, err
+		}
+		if *def.Density <= 0 {
+			return nil, l.errorAt(offset, field+".density", "must be positive")
+		}
+		boundary, err := l.buildObject(*def.Boundary, offset, field+".boundary")
+		if err != nil {
+			return nil, err
+		}
+		if len(boundary) == 0 {
+			return nil, l.errorAt(offset, field+".boundary", "must not be empty")
+		}
+		// Shapes made of several primitives, like a box, bound the medium together
+		shape := boundary[0]
+		if len(boundary) > 1 {
+			list := &utils.HittableList{}
+			for _, object := range boundary {
+				list.Add(object)
+			}
+			shape = list
+		}
+		return []utils.Hittable{material.CreateConstantMedium(shape, *def.Density, def.Color.toVec3())}, nil
+	case "model":
+		mat, err := l.lookupMaterial(def.Material, offset, field)
+		if err != nil {
+			return nil, err
+		}
+		if err := errors.Join(require("obj", def.Obj != ""), require("mtl", def.Mtl != "")); err != nil {
+			return nil, err
+		}
+		for name, path := range map[string]string{"obj": def.Obj, "mtl": def.Mtl} {
+			if _, err := os.Stat(path); err != nil {
+				return nil, l.errorAt(offset, field+"."+name, "%v", err)
+			}
+		}
+		var result []utils.Hittable
+		m, err := l.loadModel(def, offset, field)
+		if err != nil {
+			return nil, err
+		}
+		for _, triangle := range m.ToTriangles(mat, def.Textures) {
+			result = append(result, triangle)
+		}
+		return result, nil
+	case "":
+		return nil, l.errorAt(offset, field+".type", "missing")
+	}
+	return nil, l.errorAt(offset, field+".type", "unknown object type %q", def.Type)
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"github.com/philippkk/coms336/raytracer/internal/objects"
 	"github.com/philippkk/coms336/raytracer/internal/utils"
@@ -29,10 +30,12 @@ type Model struct {
 	MaterialNames        []string // Names of materials at each change point
 }
 
-func NewModel(obj, mtlFile string) Model {
+// LoadModel reads an OBJ file and its MTL library, stopping with ctx.Err() when
+// ctx is cancelled part way through
+func LoadModel(ctx context.Context, obj, mtlFile string) (Model, error) {
 	objFile, err := os.Open(obj)
 	if err != nil {
-		panic(err)
+		return Model{}, err
 	}
 	defer objFile.Close()
 
@@ -47,7 +50,10 @@ func NewModel(obj, mtlFile string) Model {
 	// Scan the file line by line
 	scanner := bufio.NewScanner(objFile)
 	triangleCount := 0
-	for scanner.Scan() {
+	for lineNumber := 0; scanner.Scan(); lineNumber++ {
+		if lineNumber%4096 == 0 && ctx.Err() != nil {
+			return Model{}, ctx.Err()
+		}
 		line := scanner.Text()
 		fields := strings.Fields(line)
 		if len(fields) == 0 {
@@ -93,9 +99,9 @@ func NewModel(obj, mtlFile string) Model {
 	}
 
 	if err := scanner.Err(); err != nil {
-		panic(err)
+		return Model{}, err
 	}
-	return model
+	return model, nil
 }
 
 func processFace(face string, model *Model) {
@@ -124,6 +130,17 @@ func processFace(face string, model *Model) {
 	}
 }
 
+// ToMesh builds the model's triangles into a BVH once, place it with utils.NewInstance
+// to reuse it many times without copying triangles
+func (model Model) ToMesh(ctx context.Context, defaultMat utils.Material, name string) (*utils.FlatBVH, error) {
+	triangles := model.ToTriangles(defaultMat, name)
+	prims := make([]utils.Hittable, len(triangles))
+	for i, triangle := range triangles {
+		prims[i] = triangle
+	}
+	return utils.NewSAHBVH(ctx, prims)
+}
+
 func (model Model) ToTriangles(defaultMat utils.Material, name string) []objects.Triangle {
 	var triangles []objects.Triangle
 
@@ -0,0 +1,55 @@
+package objects
+
+import (
+	"github.com/philippkk/coms336/raytracer/internal/utils"
+	"github.com/philippkk/coms336/raytracer/internal/utils/material"
+)
+
+// CollectLights returns the quads and spheres using a DiffuseLight material,
+// call it on the object list before building the world BVH. It looks inside
+// lists, BVHs, transforms, instances and motion so wrapped lights are sampled
+// too, moving ones where they are at time 0.
+func CollectLights(objs []utils.Hittable) []utils.Light {
+	var lights []utils.Light
+	for _, obj := range objs {
+		lights = append(lights, collectLights(obj)...)
+	}
+	return lights
+}
+
+func collectLights(obj utils.Hittable) []utils.Light {
+	switch o := obj.(type) {
+	case Quad:
+		if _, ok := o.Mat.(*material.DiffuseLight); ok {
+			return []utils.Light{o}
+		}
+	case Sphere:
+		if _, ok := o.Mat.(*material.DiffuseLight); ok {
+			return []utils.Light{o}
+		}
+	case *utils.HittableList:
+		return CollectLights(o.Objects)
+	case utils.BVHNode:
+		return append(collectLights(o.Left), collectLights(o.Right)...)
+	case *utils.FlatBVH:
+		return CollectLights(o.Primitives())
+	case *utils.Transform:
+		return placeLights(collectLights(o.Object), o.Light)
+	case *utils.Instance:
+		// An override material decides what the instance emits, not its lights
+		if o.Material == nil {
+			return placeLights(collectLights(o.Object), o.Transform.Light)
+		}
+	case *utils.Motion:
+		return placeLights(collectLights(o.Object), o.Light)
+	}
+	return nil
+}
+
+// placeLights moves lights found inside a wrapper into the world with place
+func placeLights(lights []utils.Light, place func(utils.Light) utils.Light) []utils.Light {
+	for i, light := range lights {
+		lights[i] = place(light)
+	}
+	return lights
+}
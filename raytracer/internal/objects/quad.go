@@ -102,3 +102,26 @@ func (q Quad) Hit(ray *utils.Ray, rayT utils.Interval, rec *utils.HitRecord) boo
 func (q Quad) BoundingBox() utils.AABB {
 	return q.Bbox
 }
+
+// PDFValue is the solid angle density of sampling direction from origin with Random
+func (q Quad) PDFValue(origin, direction utils.Vec3, rng *utils.RNG) float64 {
+	var rec utils.HitRecord
+	ray := utils.Ray{Origin: origin, Direction: direction, Rng: rng}
+	if !q.Hit(&ray, utils.Interval{Min: 0.001, Max: math.Inf(1)}, &rec) {
+		return 0
+	}
+
+	area := q.U.Cross(q.V).Length()
+	distanceSquared := rec.T * rec.T * direction.LengthSquared()
+	cosine := math.Abs(direction.Dot(rec.Normal) / direction.Length())
+	if cosine < 1e-8 {
+		return 0
+	}
+	return distanceSquared / (cosine * area)
+}
+
+// Random returns a direction from origin to the point u on the quad
+func (q Quad) Random(origin utils.Vec3, u utils.Vec2) utils.Vec3 {
+	p := q.Q.PlusEq(q.U.TimesConst(u.X)).PlusEq(q.V.TimesConst(u.Y))
+	return p.MinusEq(origin)
+}
@@ -62,3 +62,39 @@ func SphereUV(p utils.Vec3) (u, v float64) {
 	v = 1 - theta/math.Pi
 	return
 }
+
+// PDFValue is the solid angle density of sampling direction from origin with Random.
+// Lights are sampled at time 0, so moving spheres are treated as static.
+func (s Sphere) PDFValue(origin, direction utils.Vec3, rng *utils.RNG) float64 {
+	var rec utils.HitRecord
+	ray := utils.Ray{Origin: origin, Direction: direction, Rng: rng}
+	if !s.Hit(&ray, utils.Interval{Min: 0.001, Max: math.Inf(1)}, &rec) {
+		return 0
+	}
+
+	distanceSquared := s.Center.At(0).MinusEq(origin).LengthSquared()
+	if distanceSquared <= s.Radius*s.Radius {
+		return 1 / (4 * math.Pi)
+	}
+	cosThetaMax := math.Sqrt(1 - s.Radius*s.Radius/distanceSquared)
+	solidAngle := 2 * math.Pi * (1 - cosThetaMax)
+	return 1 / solidAngle
+}
+
+// Random returns a direction from origin inside the cone the sphere subtends
+func (s Sphere) Random(origin utils.Vec3, u utils.Vec2) utils.Vec3 {
+	direction := s.Center.At(0).MinusEq(origin)
+	distanceSquared := direction.LengthSquared()
+	if distanceSquared <= s.Radius*s.Radius {
+		return utils.SampleUniformSphere(u)
+	}
+
+	r1 := u.X
+	r2 := u.Y
+	z := 1 + r2*(math.Sqrt(1-s.Radius*s.Radius/distanceSquared)-1)
+	phi := 2 * math.Pi * r1
+	x := math.Cos(phi) * math.Sqrt(1-z*z)
+	y := math.Sin(phi) * math.Sqrt(1-z*z)
+
+	return utils.NewONB(direction).Transform(utils.Vec3{X: x, Y: y, Z: z})
+}
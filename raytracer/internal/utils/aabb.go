@@ -1,10 +1,15 @@
 package utils
 
+import "math"
+
 // AABB represents an Axis-Aligned Bounding Box
 type AABB struct {
 	X, Y, Z Interval
 }
 
+// EmptyAABB contains nothing, unlike the zero AABB which contains the origin
+var EmptyAABB = AABB{X: Empty, Y: Empty, Z: Empty}
+
 func (a *AABB) LongestAxis() int {
 	if a.X.size() > a.Y.size() {
 		if a.X.size() > a.Z.size() {
@@ -18,6 +23,27 @@ func (a *AABB) LongestAxis() int {
 
 	return 2
 }
+
+// SurfaceArea is used by the SAH BVH builder, empty boxes have no area
+func (a *AABB) SurfaceArea() float64 {
+	dx, dy, dz := a.X.size(), a.Y.size(), a.Z.size()
+	if dx < 0 || dy < 0 || dz < 0 {
+		return 0
+	}
+	return 2 * (dx*dy + dy*dz + dz*dx)
+}
+
+func (a *AABB) Centroid() Vec3 {
+	return Vec3{(a.X.Min + a.X.Max) / 2, (a.Y.Min + a.Y.Max) / 2, (a.Z.Min + a.Z.Max) / 2}
+}
+
+// ExpandToPoint grows the box to contain p
+func (a *AABB) ExpandToPoint(p Vec3) {
+	a.X = Interval{math.Min(a.X.Min, p.X), math.Max(a.X.Max, p.X)}
+	a.Y = Interval{math.Min(a.Y.Min, p.Y), math.Max(a.Y.Max, p.Y)}
+	a.Z = Interval{math.Min(a.Z.Min, p.Z), math.Max(a.Z.Max, p.Z)}
+}
+
 func (a *AABB) PadToMinimums() {
 	delta := 0.0001
 	if a.X.size() < delta {
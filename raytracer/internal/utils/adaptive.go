@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// adaptiveBatch is how many samples are taken between convergence checks,
+	// checking after every sample would stop too eagerly on lucky streaks
+	adaptiveBatch = 8
+
+	// defaultMinSamples is used when Camera.MinSamples is not set
+	defaultMinSamples = 16
+
+	// adaptiveFloor keeps near black pixels from needing a tiny absolute error
+	adaptiveFloor = 0.01
+)
+
+// pixelStats is the running mean and variance of a pixel's luminance (Welford)
+type pixelStats struct {
+	n        int
+	mean, m2 float64
+}
+
+func (p *pixelStats) add(v float64) {
+	p.n++
+	delta := v - p.mean
+	p.mean += delta / float64(p.n)
+	p.m2 += delta * (v - p.mean)
+}
+
+// converged reports whether the standard error of the mean is below threshold
+// relative to the mean
+func (p *pixelStats) converged(threshold float64) bool {
+	if p.n < 2 {
+		return false
+	}
+	variance := p.m2 / float64(p.n-1)
+	stdErr := math.Sqrt(variance / float64(p.n))
+	return stdErr <= threshold*math.Max(p.mean, adaptiveFloor)
+}
+
+func luminance(c Vec3) float64 {
+	return 0.2126*c.X + 0.7152*c.Y + 0.0722*c.Z
+}
+
+// heatmapColors goes from dark blue for few samples to yellow for the most
+var heatmapColors = [...]Vec3{
+	{0.05, 0.03, 0.3},
+	{0.2, 0.2, 0.85},
+	{0.1, 0.75, 0.75},
+	{0.95, 0.5, 0.1},
+	{1, 0.95, 0.3},
+}
+
+// SampleHeatmap draws how many samples every pixel of a render took,
+// maxSamples maps to the hottest color
+func SampleHeatmap(f *Framebuffer, maxSamples int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, f.Width, f.Height))
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			t := math.Min(float64(f.Samples[y*f.Width+x])/float64(max(maxSamples, 1)), 1)
+			scaled := t * float64(len(heatmapColors)-1)
+			i := min(int(scaled), len(heatmapColors)-2)
+			f := scaled - float64(i)
+			c := heatmapColors[i].TimesConst(1 - f).PlusEq(heatmapColors[i+1].TimesConst(f))
+			img.Set(x, y, color.RGBA{
+				R: uint8(255 * c.X),
+				G: uint8(255 * c.Y),
+				B: uint8(255 * c.Z),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
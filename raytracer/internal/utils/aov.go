@@ -0,0 +1,310 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// AOV is an auxiliary pass describing what the camera rays hit first, used
+// to guide denoisers and for compositing
+type AOV int
+
+const (
+	AOVAlbedo     AOV = iota // surface reflectance
+	AOVNormal                // world space shading normal
+	AOVPosition              // world space hit point
+	AOVDepth                 // distance from the camera, +Inf where nothing was hit
+	AOVUV                    // texture coordinates
+	AOVMaterialID            // 1 for the first material seen in raster order, 2 for the next...
+	AOVObjectID              // ID given with Tagged, 0 for the background and untagged objects
+)
+
+var aovNames = map[AOV]string{
+	AOVAlbedo:     "albedo",
+	AOVNormal:     "normal",
+	AOVPosition:   "position",
+	AOVDepth:      "depth",
+	AOVUV:         "uv",
+	AOVMaterialID: "material_id",
+	AOVObjectID:   "object_id",
+}
+
+func (a AOV) String() string {
+	if name, ok := aovNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("AOV(%d)", int(a))
+}
+
+// ParseAOVs reads a comma separated list of passes, "all" selects every one.
+// A pass named twice is kept once.
+func ParseAOVs(list string) ([]AOV, error) {
+	var aovs []AOV
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			return []AOV{AOVAlbedo, AOVNormal, AOVPosition, AOVDepth, AOVUV, AOVMaterialID, AOVObjectID}, nil
+		}
+		aov, err := ParseAOV(name)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(aovs, aov) {
+			aovs = append(aovs, aov)
+		}
+	}
+	return aovs, nil
+}
+
+func ParseAOV(name string) (AOV, error) {
+	for a, n := range aovNames {
+		if n == name {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown AOV %q, expected albedo, normal, position, depth, uv, material_id, object_id or all", name)
+}
+
+// Channels names the values the pass stores for every pixel
+func (a AOV) Channels() []string {
+	switch a {
+	case AOVAlbedo:
+		return []string{"R", "G", "B"}
+	case AOVNormal, AOVPosition:
+		return []string{"X", "Y", "Z"}
+	case AOVDepth:
+		return []string{"Z"}
+	case AOVUV:
+		return []string{"U", "V"}
+	}
+	return []string{"id"}
+}
+
+// AlbedoMaterial is implemented by materials that know their reflectance,
+// the albedo pass shows white for the others
+type AlbedoMaterial interface {
+	AlbedoAt(rec *HitRecord) Vec3
+}
+
+// Tagged gives every hit on Object the ID the object ID pass shows
+type Tagged struct {
+	Object Hittable
+	ID     int32
+}
+
+func (t Tagged) BoundingBox() AABB {
+	return t.Object.BoundingBox()
+}
+
+func (t Tagged) Hit(r *Ray, rayT Interval, rec *HitRecord) bool {
+	if !t.Object.Hit(r, rayT, rec) {
+		return false
+	}
+	rec.ObjectID = t.ID
+	return true
+}
+
+// TagObjects wraps every object so the object ID pass numbers them from 1
+func TagObjects(objects []Hittable) []Hittable {
+	tagged := make([]Hittable, len(objects))
+	for i, object := range objects {
+		tagged[i] = Tagged{object, int32(i + 1)}
+	}
+	return tagged
+}
+
+// aovPixel sums up what the camera rays of one pixel hit first. The IDs can't
+// be averaged, they come from the first sample.
+type aovPixel struct {
+	samples, hits            int
+	albedo, normal, position Vec3
+	depth, u, v              float64
+	material                 Material
+	object                   int32
+}
+
+// addAOVSample traces r again to find its first hit. It runs after rayColor so
+// the RNG draws a participating medium makes don't change the image.
+func (p *aovPixel) addAOVSample(r Ray, world Hittable) {
+	p.samples++
+	var rec HitRecord
+	if r.Direction == (Vec3{}) || !world.Hit(&r, Interval{0.001, math.Inf(+1)}, &rec) {
+		return
+	}
+	if p.samples == 1 {
+		p.material = rec.Mat
+		p.object = rec.ObjectID
+	}
+	p.hits++
+
+	albedo := Vec3{1, 1, 1}
+	if mat, ok := rec.Mat.(AlbedoMaterial); ok {
+		albedo = mat.AlbedoAt(&rec)
+	}
+	p.albedo = p.albedo.PlusEq(albedo)
+	p.normal = p.normal.PlusEq(rec.Normal)
+	p.position = p.position.PlusEq(rec.P)
+	p.depth += rec.T * r.Direction.Length()
+	p.u += rec.U
+	p.v += rec.V
+}
+
+// fillAOVs stores the requested passes of the image's pixels in f. Materials
+// are numbered in raster order so the IDs don't depend on thread timing.
+func fillAOVs(f *Framebuffer, aovs []AOV, pixels []aovPixel) {
+	if len(aovs) == 0 {
+		return
+	}
+	f.AOVs = make(map[AOV][]float32, len(aovs))
+	for _, aov := range aovs {
+		f.AOVs[aov] = make([]float32, len(pixels)*len(aov.Channels()))
+	}
+
+	materialIDs := make(map[Material]int32)
+	var lastID int32
+	materialID := func(m Material) int32 {
+		if m == nil {
+			return 0
+		}
+		// Materials that can't be map keys get an ID of their own every time
+		if !reflect.TypeOf(m).Comparable() {
+			lastID++
+			return lastID
+		}
+		id, ok := materialIDs[m]
+		if !ok {
+			lastID++
+			id = lastID
+			materialIDs[m] = id
+		}
+		return id
+	}
+
+	for i, p := range pixels {
+		samples := 1 / float64(max(p.samples, 1))
+		hits := 1 / float64(max(p.hits, 1))
+		for _, aov := range aovs {
+			var values []float64
+			switch aov {
+			case AOVAlbedo:
+				values = p.albedo.TimesConst(samples).toSlice()
+			case AOVNormal:
+				if p.hits > 0 {
+					values = p.normal.UnitVector().toSlice()
+				}
+			case AOVPosition:
+				values = p.position.TimesConst(hits).toSlice()
+			case AOVDepth:
+				values = []float64{math.Inf(+1)}
+				if p.hits > 0 {
+					values[0] = p.depth * hits
+				}
+			case AOVUV:
+				values = []float64{p.u * hits, p.v * hits}
+			case AOVMaterialID:
+				values = []float64{float64(materialID(p.material))}
+			case AOVObjectID:
+				values = []float64{float64(p.object)}
+			}
+			data := f.AOVs[aov]
+			stride := len(aov.Channels())
+			for c, v := range values {
+				data[i*stride+c] = float32(v)
+			}
+		}
+	}
+}
+
+func (v Vec3) toSlice() []float64 {
+	return []float64{v.X, v.Y, v.Z}
+}
+
+// AOVChannels are the given passes as EXR layers named like "albedo.R". Depth,
+// position and the IDs stay 32 bit floats since half floats lose them.
+func (f *Framebuffer) AOVChannels(aovs []AOV, t EXRPixelType) []EXRChannel {
+	var channels []EXRChannel
+	for _, aov := range aovs {
+		data := f.AOVs[aov]
+		pixelType := t
+		if aov == AOVDepth || aov == AOVPosition || aov == AOVMaterialID || aov == AOVObjectID {
+			pixelType = EXRFloat
+		}
+		names := aov.Channels()
+		for c, name := range names {
+			values := make([]float32, f.Width*f.Height)
+			for i := range values {
+				values[i] = data[i*len(names)+c]
+			}
+			channels = append(channels, EXRChannel{Name: aov.String() + "." + name, Type: pixelType, Data: values})
+		}
+	}
+	return channels
+}
+
+// AOVPreview draws a pass as an 8 bit image: normals mapped from [-1, 1],
+// depth and position scaled to what is in view and IDs as random colors
+func (f *Framebuffer) AOVPreview(aov AOV) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, f.Width, f.Height))
+	data := f.AOVs[aov]
+	stride := len(aov.Channels())
+
+	// Scale depth and position by the largest finite value
+	scale := 0.0
+	for _, v := range data {
+		if !math.IsInf(float64(v), 0) {
+			scale = math.Max(scale, math.Abs(float64(v)))
+		}
+	}
+	scale = 1 / math.Max(scale, 1e-9)
+
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			i := (y*f.Width + x) * stride
+			var c Vec3
+			switch aov {
+			case AOVAlbedo:
+				c = Vec3{LinearToSRGB(float64(data[i])), LinearToSRGB(float64(data[i+1])), LinearToSRGB(float64(data[i+2]))}
+			case AOVNormal:
+				c = Vec3{float64(data[i]), float64(data[i+1]), float64(data[i+2])}.TimesConst(0.5).PlusEq(Vec3{0.5, 0.5, 0.5})
+			case AOVPosition:
+				c = Vec3{float64(data[i]), float64(data[i+1]), float64(data[i+2])}.TimesConst(0.5 * scale).PlusEq(Vec3{0.5, 0.5, 0.5})
+			case AOVDepth:
+				// Near is bright, nothing hit is black
+				d := float64(data[i])
+				if !math.IsInf(d, 0) {
+					v := 1 - d*scale
+					c = Vec3{v, v, v}
+				}
+			case AOVUV:
+				c = Vec3{float64(data[i]), float64(data[i+1]), 0}
+			default:
+				c = idColor(int32(data[i]))
+			}
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(255 * math.Max(0, math.Min(1, c.X))),
+				G: uint8(255 * math.Max(0, math.Min(1, c.Y))),
+				B: uint8(255 * math.Max(0, math.Min(1, c.Z))),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+// idColor gives every ID a stable random color, 0 stays black
+func idColor(id int32) Vec3 {
+	if id == 0 {
+		return Vec3{}
+	}
+	h := mixBits(uint64(id))
+	return Vec3{
+		0.2 + 0.8*float64(h&0xff)/255,
+		0.2 + 0.8*float64(h>>8&0xff)/255,
+		0.2 + 0.8*float64(h>>16&0xff)/255,
+	}
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseAOVs(t *testing.T) {
+	all := []AOV{AOVAlbedo, AOVNormal, AOVPosition, AOVDepth, AOVUV, AOVMaterialID, AOVObjectID}
+	tests := []struct {
+		list string
+		want []AOV
+	}{
+		{"albedo", []AOV{AOVAlbedo}},
+		{"depth, normal", []AOV{AOVDepth, AOVNormal}},
+		{"albedo,albedo", []AOV{AOVAlbedo}},
+		{"depth,uv,depth", []AOV{AOVDepth, AOVUV}},
+		{"all", all},
+		{"depth,all", all},
+	}
+	for _, tt := range tests {
+		got, err := ParseAOVs(tt.list)
+		if err != nil {
+			t.Errorf("ParseAOVs(%q): %v", tt.list, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ParseAOVs(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+	if _, err := ParseAOVs("albedo,shadow"); err == nil {
+		t.Error("ParseAOVs accepted an unknown pass")
+	}
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"math"
+	"sort"
+)
+
+// Aperture is the shape of the lens opening, which is the shape out of focus
+// highlights take. The zero value is a round opening.
+type Aperture struct {
+	// Blades makes the opening a regular polygon with that many corners, below
+	// 3 it stays round
+	Blades int
+	// Rotation of the blades or the mask in degrees
+	Rotation float64
+	// Mask is an image of the opening, brighter parts let more light through.
+	// It wins over Blades.
+	Mask *ApertureMask
+	// CatEye clips the opening towards the image borders like the barrel of a
+	// real lens does, so bokeh there turns into cat's eyes and the corners get
+	// darker. 0 turns it off, around 0.5 looks like a fast lens wide open.
+	CatEye float64
+}
+
+// Sample maps u to a point on the opening, which fits the unit disk
+func (a Aperture) Sample(u Vec2) Vec3 {
+	var p Vec3
+	switch {
+	case a.Mask != nil:
+		p = a.Mask.sample(u)
+	case a.Blades >= 3:
+		p = samplePolygon(a.Blades, u)
+	default:
+		return SampleUnitDisk(u)
+	}
+	if a.Rotation == 0 {
+		return p
+	}
+	sin, cos := math.Sincos(DegreesToRadians(a.Rotation))
+	return Vec3{p.X*cos - p.Y*sin, p.X*sin + p.Y*cos, 0}
+}
+
+// samplePolygon maps u uniformly to the regular polygon with n corners on the
+// unit circle, the first one pointing up
+func samplePolygon(n int, u Vec2) Vec3 {
+	// u.X picks the triangle between the center and one edge and is then reused
+	x := u.X * float64(n)
+	sector := min(int(x), n-1)
+	x -= float64(sector)
+
+	angle := 2 * pi / float64(n)
+	a0 := pi/2 + float64(sector)*angle
+	a1 := a0 + angle
+	// Uniform on the triangle, sqrt keeps the density even towards the edge
+	r := math.Sqrt(x)
+	b := u.Y
+	return Vec3{
+		r * ((1-b)*math.Cos(a0) + b*math.Cos(a1)),
+		r * ((1-b)*math.Sin(a0) + b*math.Sin(a1)),
+		0,
+	}
+}
+
+// catEyeBlocked reports whether the barrel blocks the lens point p for film
+// position x, y, both from -1 to 1 across the image's longer side. The
+// barrel is a second unit disk pushed outwards as the pixel moves off center,
+// only the part of the opening inside both lets light through.
+func (a Aperture) catEyeBlocked(p Vec3, x, y float64) bool {
+	if a.CatEye <= 0 {
+		return false
+	}
+	dx := p.X - a.CatEye*x
+	dy := p.Y - a.CatEye*y
+	return dx*dx+dy*dy > 1
+}
+
+// apertureMaskSize is the most cells per side a mask is sampled with
+const apertureMaskSize = 64
+
+// ApertureMask is an aperture shape drawn as an image, light comes through
+// in proportion to its brightness
+type ApertureMask struct {
+	width, height int
+	// rows is the cumulative brightness of every row, cells the cumulative
+	// brightness of the cells in each row
+	rows  []float64
+	cells [][]float64
+}
+
+// NewApertureMask loads an aperture shape from a PNG or JPEG image
+func NewApertureMask(filename string) (*ApertureMask, error) {
+	texture, err := NewImageTexture(filename)
+	if err != nil {
+		return nil, err
+	}
+	return newApertureMask(texture), nil
+}
+
+func newApertureMask(t *ImageTexture) *ApertureMask {
+	m := &ApertureMask{
+		width:  min(t.Width, apertureMaskSize),
+		height: min(t.Height, apertureMaskSize),
+	}
+	m.rows = make([]float64, m.height)
+	m.cells = make([][]float64, m.height)
+	total := 0.0
+	for y := 0; y < m.height; y++ {
+		m.cells[y] = make([]float64, m.width)
+		rowSum := 0.0
+		for x := 0; x < m.width; x++ {
+			rowSum += t.cellBrightness(x*t.Width/m.width, y*t.Height/m.height, (x+1)*t.Width/m.width, (y+1)*t.Height/m.height)
+			m.cells[y][x] = rowSum
+		}
+		total += rowSum
+		m.rows[y] = total
+	}
+	return m
+}
+
+// cellBrightness is the mean brightness of the pixels from x0, y0 up to x1, y1
+func (t *ImageTexture) cellBrightness(x0, y0, x1, y1 int) float64 {
+	sum := 0.0
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			i := y*t.Image.Stride + x*4
+			sum += 0.2126*float64(t.Image.Pix[i]) + 0.7152*float64(t.Image.Pix[i+1]) + 0.0722*float64(t.Image.Pix[i+2])
+		}
+	}
+	return sum / float64(max(1, (x1-x0)*(y1-y0)))
+}
+
+// sample picks a cell in proportion to its brightness and a point inside it,
+// the image spans the unit disk's bounding square with up at the top
+func (m *ApertureMask) sample(u Vec2) Vec3 {
+	total := m.rows[m.height-1]
+	if total <= 0 {
+		return Vec3{}
+	}
+	y, fy := sampleCDF(m.rows, u.Y*total)
+	row := m.cells[y]
+	x, fx := sampleCDF(row, u.X*row[m.width-1])
+	return Vec3{
+		2*(float64(x)+fx)/float64(m.width) - 1,
+		1 - 2*(float64(y)+fy)/float64(m.height),
+		0,
+	}
+}
+
+// sampleCDF finds the entry of the running sum cdf that v falls into and how
+// far into it, from 0 to 1
+func sampleCDF(cdf []float64, v float64) (int, float64) {
+	i := min(sort.SearchFloat64s(cdf, v), len(cdf)-1)
+	// Skip cells that let no light through
+	for i < len(cdf)-1 && cdf[i] <= v {
+		i++
+	}
+	start := 0.0
+	if i > 0 {
+		start = cdf[i-1]
+	}
+	if cdf[i] <= start {
+		return i, 0.5
+	}
+	return i, math.Min(1, math.Max(0, (v-start)/(cdf[i]-start)))
+}
@@ -86,8 +86,19 @@ func NewBVHNode(objects []Hittable, start, end int) BVHNode {
 		})
 
 		mid := start + objectSpan/2
-		node.Left = NewBVHNode(objects, start, mid)
-		node.Right = NewBVHNode(objects, mid, end)
+		if objectSpan >= parallelBuildThreshold {
+			// The halves don't overlap so they can be sorted and built at the same time
+			var left, right BVHNode
+			Parallelize(
+				func() { left = NewBVHNode(objects, start, mid) },
+				func() { right = NewBVHNode(objects, mid, end) },
+			)
+			node.Left = left
+			node.Right = right
+		} else {
+			node.Left = NewBVHNode(objects, start, mid)
+			node.Right = NewBVHNode(objects, mid, end)
+		}
 	}
 
 	node.Box = SurroundingBox(node.Left.BoundingBox(), node.Right.BoundingBox())
@@ -0,0 +1,367 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	sahBins          = 12
+	sahTraversalCost = 0.5 // relative to one primitive intersection
+	maxLeafPrims     = 4
+
+	// Ranges at least this big are split across goroutines while building
+	parallelBuildThreshold = 4096
+)
+
+// flatBVHNode is one entry of FlatBVH.nodes. Interior nodes keep their first
+// child right after themselves and store the index of the second one in offset,
+// leaves store the range of their primitives in offset/count.
+type flatBVHNode struct {
+	box    AABB
+	offset int32
+	count  int32 // 0 for interior nodes
+	axis   uint8 // split axis, used to visit the nearer child first
+}
+
+// FlatBVH is a BVH built with the binned surface area heuristic and stored as a
+// depth first array of nodes, the alternative to the pointer based BVHNode
+type FlatBVH struct {
+	nodes []flatBVHNode
+	prims []Hittable
+	stats BVHStats
+}
+
+// BVHStats describes a FlatBVH after it is built
+type BVHStats struct {
+	Nodes, Leaves, Prims     int
+	MaxDepth                 int
+	MinLeafSize, MaxLeafSize int
+	AvgLeafSize              float64
+	SAHCost                  float64
+	BuildTime                time.Duration
+}
+
+func (s BVHStats) String() string {
+	return fmt.Sprintf("%d prims, %d nodes, %d leaves (size %d-%d, avg %.2f), depth %d, SAH cost %.2f, built in %v",
+		s.Prims, s.Nodes, s.Leaves, s.MinLeafSize, s.MaxLeafSize, s.AvgLeafSize, s.MaxDepth, s.SAHCost, s.BuildTime)
+}
+
+type sahBuilder struct {
+	ctx       context.Context
+	objects   []Hittable
+	boxes     []AABB
+	centroids []Vec3
+	indices   []int
+	nodes     []flatBVHNode
+}
+
+type sahBin struct {
+	box   AABB
+	count int
+}
+
+// NewSAHBVH builds a FlatBVH over objects, the slice itself is left untouched.
+// Large inputs are built on several goroutines, the result is the same tree the
+// serial build gives. It gives up with ctx.Err() once ctx is cancelled.
+func NewSAHBVH(ctx context.Context, objects []Hittable) (*FlatBVH, error) {
+	t := time.Now()
+
+	b := sahBuilder{
+		ctx:       ctx,
+		objects:   objects,
+		boxes:     make([]AABB, len(objects)),
+		centroids: make([]Vec3, len(objects)),
+		indices:   make([]int, len(objects)),
+		nodes:     make([]flatBVHNode, 0, 2*len(objects)),
+	}
+	parallelChunks(len(objects), func(start, end int) {
+		for i := start; i < end; i++ {
+			b.boxes[i] = objects[i].BoundingBox()
+			b.centroids[i] = b.boxes[i].Centroid()
+			b.indices[i] = i
+		}
+	})
+
+	bvh := &FlatBVH{}
+	if len(objects) > 0 {
+		b.build(0, len(objects))
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bvh.nodes = b.nodes
+	bvh.prims = make([]Hittable, len(objects))
+	for i, index := range b.indices {
+		bvh.prims[i] = objects[index]
+	}
+
+	bvh.stats = bvh.computeStats()
+	bvh.stats.BuildTime = time.Since(t)
+	return bvh, nil
+}
+
+// build appends the subtree over indices[start:end] and returns its node index
+func (b *sahBuilder) build(start, end int) int {
+	nodeIndex := len(b.nodes)
+	b.nodes = append(b.nodes, flatBVHNode{})
+
+	bounds, centroidBounds := b.rangeBounds(start, end)
+
+	count := end - start
+	axis := centroidBounds.LongestAxis()
+	extent := centroidBounds.AxisInterval(axis)
+
+	makeLeaf := func() int {
+		b.nodes[nodeIndex] = flatBVHNode{box: bounds, offset: int32(start), count: int32(count)}
+		return nodeIndex
+	}
+	// A cancelled build only needs to unwind, the tree is thrown away
+	if count == 1 || b.ctx.Err() != nil {
+		return makeLeaf()
+	}
+
+	var mid int
+	if extent.size() <= 0 {
+		// Every centroid is in the same spot, binning can't separate them
+		if count <= maxLeafPrims {
+			return makeLeaf()
+		}
+		mid = start + count/2
+	} else {
+		var bins [sahBins]sahBin
+		for i := range bins {
+			bins[i].box = EmptyAABB
+		}
+		binOf := func(index int) int {
+			bin := int(sahBins * (b.centroids[index].Get(axis) - extent.Min) / extent.size())
+			return min(bin, sahBins-1)
+		}
+		for _, index := range b.indices[start:end] {
+			bin := binOf(index)
+			bins[bin].count++
+			bins[bin].box = SurroundingBox(bins[bin].box, b.boxes[index])
+		}
+
+		// Sweep from the right to get the cost of everything past each split
+		var rightArea [sahBins]float64
+		var rightCount [sahBins]int
+		accBox, accCount := EmptyAABB, 0
+		for i := sahBins - 1; i > 0; i-- {
+			accBox = SurroundingBox(accBox, bins[i].box)
+			accCount += bins[i].count
+			rightArea[i] = accBox.SurfaceArea()
+			rightCount[i] = accCount
+		}
+
+		bestSplit, bestCost := -1, math.Inf(1)
+		accBox, accCount = EmptyAABB, 0
+		for i := 0; i < sahBins-1; i++ {
+			accBox = SurroundingBox(accBox, bins[i].box)
+			accCount += bins[i].count
+			if accCount == 0 || rightCount[i+1] == 0 {
+				continue
+			}
+			cost := accBox.SurfaceArea()*float64(accCount) + rightArea[i+1]*float64(rightCount[i+1])
+			if cost < bestCost {
+				bestSplit, bestCost = i, cost
+			}
+		}
+
+		area := bounds.SurfaceArea()
+		if area > 0 {
+			bestCost = sahTraversalCost + bestCost/area
+		}
+		if bestSplit < 0 || (count <= maxLeafPrims && bestCost >= float64(count)) {
+			if count <= maxLeafPrims {
+				return makeLeaf()
+			}
+			mid = start + count/2
+		} else {
+			// Partition the indices around the chosen bin boundary
+			i, j := start, end-1
+			for i <= j {
+				if binOf(b.indices[i]) <= bestSplit {
+					i++
+				} else {
+					b.indices[i], b.indices[j] = b.indices[j], b.indices[i]
+					j--
+				}
+			}
+			mid = i
+		}
+	}
+	if mid == start || mid == end {
+		mid = start + count/2
+	}
+
+	var second int
+	if count >= parallelBuildThreshold {
+		// Build both halves into their own node lists, then splice them in
+		// depth first order so the layout matches a serial build
+		left := sahBuilder{ctx: b.ctx, objects: b.objects, boxes: b.boxes, centroids: b.centroids, indices: b.indices}
+		right := left
+		Parallelize(
+			func() { left.build(start, mid) },
+			func() { right.build(mid, end) },
+		)
+		b.appendSubtree(left.nodes)
+		second = len(b.nodes)
+		b.appendSubtree(right.nodes)
+	} else {
+		b.build(start, mid)
+		second = b.build(mid, end)
+	}
+	b.nodes[nodeIndex] = flatBVHNode{box: bounds, offset: int32(second), axis: uint8(axis)}
+	return nodeIndex
+}
+
+// appendSubtree copies nodes built by another sahBuilder, moving their child links
+func (b *sahBuilder) appendSubtree(nodes []flatBVHNode) {
+	base := int32(len(b.nodes))
+	for _, node := range nodes {
+		if node.count == 0 {
+			node.offset += base
+		}
+		b.nodes = append(b.nodes, node)
+	}
+}
+
+// rangeBounds returns the bounds of indices[start:end] and of their centroids
+func (b *sahBuilder) rangeBounds(start, end int) (AABB, AABB) {
+	type partial struct{ bounds, centroids AABB }
+	var results []partial
+	var mu sync.Mutex
+
+	parallelChunks(end-start, func(chunkStart, chunkEnd int) {
+		p := partial{EmptyAABB, EmptyAABB}
+		for _, index := range b.indices[start+chunkStart : start+chunkEnd] {
+			p.bounds = SurroundingBox(p.bounds, b.boxes[index])
+			p.centroids.ExpandToPoint(b.centroids[index])
+		}
+		mu.Lock()
+		results = append(results, p)
+		mu.Unlock()
+	})
+
+	// min/max don't depend on the order the chunks finished in
+	bounds, centroids := EmptyAABB, EmptyAABB
+	for _, p := range results {
+		bounds = SurroundingBox(bounds, p.bounds)
+		centroids = SurroundingBox(centroids, p.centroids)
+	}
+	return bounds, centroids
+}
+
+// parallelChunks calls fn over [0, n) in one go when n is small and on one
+// goroutine per CPU otherwise
+func parallelChunks(n int, fn func(start, end int)) {
+	if n < parallelBuildThreshold {
+		fn(0, n)
+		return
+	}
+	chunks := runtime.NumCPU()
+	size := (n + chunks - 1) / chunks
+	var functions []func()
+	for start := 0; start < n; start += size {
+		end := min(start+size, n)
+		functions = append(functions, func() { fn(start, end) })
+	}
+	Parallelize(functions...)
+}
+
+func (f *FlatBVH) computeStats() BVHStats {
+	stats := BVHStats{Nodes: len(f.nodes), Prims: len(f.prims), MinLeafSize: math.MaxInt}
+	if len(f.nodes) == 0 {
+		stats.MinLeafSize = 0
+		return stats
+	}
+	rootArea := f.nodes[0].box.SurfaceArea()
+
+	var walk func(index, depth int)
+	walk = func(index, depth int) {
+		node := &f.nodes[index]
+		stats.MaxDepth = max(stats.MaxDepth, depth)
+		relArea := 1.0
+		if rootArea > 0 {
+			relArea = node.box.SurfaceArea() / rootArea
+		}
+		if node.count > 0 {
+			stats.Leaves++
+			stats.MinLeafSize = min(stats.MinLeafSize, int(node.count))
+			stats.MaxLeafSize = max(stats.MaxLeafSize, int(node.count))
+			stats.SAHCost += relArea * float64(node.count)
+			return
+		}
+		stats.SAHCost += relArea * sahTraversalCost
+		walk(index+1, depth+1)
+		walk(int(node.offset), depth+1)
+	}
+	walk(0, 0)
+
+	stats.AvgLeafSize = float64(stats.Prims) / float64(stats.Leaves)
+	return stats
+}
+
+func (f *FlatBVH) Stats() BVHStats {
+	return f.stats
+}
+
+// Primitives are the objects the BVH was built over, in leaf order
+func (f *FlatBVH) Primitives() []Hittable {
+	return f.prims
+}
+
+func (f *FlatBVH) BoundingBox() AABB {
+	if len(f.nodes) == 0 {
+		return EmptyAABB
+	}
+	return f.nodes[0].box
+}
+
+func (f *FlatBVH) Hit(ray *Ray, rayT Interval, rec *HitRecord) bool {
+	if len(f.nodes) == 0 {
+		return false
+	}
+
+	dirIsNeg := [3]bool{ray.Direction.X < 0, ray.Direction.Y < 0, ray.Direction.Z < 0}
+	var stackBuf [64]int
+	stack := stackBuf[:0]
+
+	hitAnything := false
+	closestSoFar := rayT.Max
+	current := 0
+	for {
+		node := &f.nodes[current]
+		if node.box.Hit(ray, Interval{rayT.Min, closestSoFar}) {
+			if node.count > 0 {
+				for _, prim := range f.prims[node.offset : node.offset+node.count] {
+					if prim.Hit(ray, Interval{rayT.Min, closestSoFar}, rec) {
+						hitAnything = true
+						closestSoFar = rec.T
+					}
+				}
+			} else {
+				// Visit the child on the ray's side of the split first
+				if dirIsNeg[node.axis] {
+					stack = append(stack, current+1)
+					current = int(node.offset)
+				} else {
+					stack = append(stack, int(node.offset))
+					current = current + 1
+				}
+				continue
+			}
+		}
+		if len(stack) == 0 {
+			break
+		}
+		current = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+	}
+	return hitAnything
+}
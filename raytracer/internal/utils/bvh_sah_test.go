@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// TestBVHsMatchBruteForce checks both BVH builders find the same closest hit
+// as testing every object, for random rays through random scenes
+func TestBVHsMatchBruteForce(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects int
+	}{
+		{"single", 1},
+		{"one leaf", maxLeafPrims},
+		{"few", 17},
+		{"many", 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := NewRNG(uint64(tt.objects))
+			objects := randomSpheres(rng, tt.objects)
+			brute := &HittableList{}
+			for _, o := range objects {
+				brute.Add(o)
+			}
+			sah, err := NewSAHBVH(context.Background(), append([]Hittable(nil), objects...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			median := append([]Hittable(nil), objects...)
+			builders := map[string]Hittable{
+				"sah":    sah,
+				"median": NewBVHNode(median, 0, len(median)),
+			}
+
+			for i := 0; i < 2000; i++ {
+				origin := Vec3{rng.FloatInRange(-15, 15), rng.FloatInRange(-15, 15), rng.FloatInRange(-15, 15)}
+				ray := Ray{Origin: origin, Direction: rng.UnitVector().TimesConst(rng.FloatInRange(0.5, 2))}
+				rayT := Interval{0.001, math.Inf(1)}
+
+				var want HitRecord
+				wantHit := brute.Hit(&ray, rayT, &want)
+				for name, bvh := range builders {
+					var got HitRecord
+					gotHit := bvh.Hit(&ray, rayT, &got)
+					if gotHit != wantHit {
+						t.Fatalf("%s: ray %d hit = %v, brute force %v", name, i, gotHit, wantHit)
+					}
+					if gotHit && (!nearlyEqual(got.T, want.T, 1e-9) || !vecNearlyEqual(got.P, want.P, 1e-9)) {
+						t.Fatalf("%s: ray %d hit t=%v p=%v, brute force t=%v p=%v", name, i, got.T, got.P, want.T, want.P)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSAHBVHStats(t *testing.T) {
+	objects := randomSpheres(NewRNG(1), 300)
+	bvh, err := NewSAHBVH(context.Background(), objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := bvh.Stats()
+	if stats.Prims != len(objects) {
+		t.Errorf("Prims = %d, want %d", stats.Prims, len(objects))
+	}
+	if stats.MaxLeafSize > maxLeafPrims {
+		t.Errorf("MaxLeafSize = %d, want at most %d", stats.MaxLeafSize, maxLeafPrims)
+	}
+	if len(bvh.Primitives()) != len(objects) {
+		t.Errorf("len(Primitives()) = %d, want %d", len(bvh.Primitives()), len(objects))
+	}
+	box := bvh.BoundingBox()
+	for _, o := range objects {
+		b := o.BoundingBox()
+		if b.X.Min < box.X.Min || b.X.Max > box.X.Max || b.Y.Min < box.Y.Min || b.Y.Max > box.Y.Max || b.Z.Min < box.Z.Min || b.Z.Max > box.Z.Max {
+			t.Fatalf("object box %v is not inside the BVH box %v", b, box)
+		}
+	}
+}
+
+func TestSAHBVHCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewSAHBVH(ctx, randomSpheres(NewRNG(2), parallelBuildThreshold*2)); err == nil {
+		t.Error("NewSAHBVH with a cancelled context returned no error")
+	}
+}
@@ -1,10 +1,11 @@
 package utils
 
 import (
+	"context"
 	"fmt"
-	"image/color"
 	"math"
 	"runtime"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -18,13 +19,54 @@ type Camera struct {
 	DefocusAngle, Focusdist                                             float64
 	Cube                                                                CubeMap
 	SkipCube                                                            bool
+	Lights                                                              []Light // emissive primitives sampled directly at diffuse hits
+	Seed                                                                uint64  // the same seed renders the same image
+	Sampler                                                             SamplerType
+	ToneMap                                                             ToneMapper // how previews and 8 bit images show the linear result
+	AOVs                                                                []AOV      // auxiliary passes to store next to the color
+	Denoiser                                                            *Denoiser  // filters previews and saved images when set
+	Filter                                                              PixelFilter
+	Projection                                                          Projection
+	OrthoHeight                                                         float64 // world units the orthographic view spans vertically, 0 keeps what Vfov sees at Focusdist
+	FisheyeFOV                                                          float64 // degrees the fisheye's image circle covers, 0 means 180
+	CubeFace                                                            int     // face a cube projection renders, RIGHT to BACK
+	Stereo                                                              StereoMode
+	InterocularDistance                                                 float64 // distance between the eyes in world units, 0 means 0.065
+	Convergence                                                         float64 // distance at which the eyes' views meet, 0 means Focusdist
+	eyeWidth, eyeHeight                                                 int
+	Physical                                                            *PhysicalCamera // replaces Vfov and DefocusAngle and exposes like a real camera when set
+	Aperture                                                            Aperture        // shape of the lens opening
+	lensRadius, sensorScale                                             float64
+	ShutterOpen, ShutterClose                                           float64 // scene times motion blur covers, both 0 means 0 to 1
+	ShutterCurve                                                        ShutterCurve
+
+	// Adaptive sampling: with a NoiseThreshold above 0 a pixel stops once the
+	// relative error of its mean is below it, after at least MinSamples and at
+	// most SamplesPerPixel samples
+	NoiseThreshold float64
+	MinSamples     int
 }
 type Tile struct {
 	x, y          int // Top-left corner
 	width, height int
+	index         int // position in raster order
 }
 
-func (c *Camera) Render(world HittableList, display *DisplayBuffer, pixels []byte) time.Duration {
+// RenderResult is the image a Render call produced and how much of it finished
+type RenderResult struct {
+	Image            *Framebuffer
+	Duration         time.Duration
+	TilesDone, Tiles int
+}
+
+func (r RenderResult) Complete() bool {
+	return r.TilesDone == r.Tiles
+}
+
+// Render traces the image tile by tile into an HDR framebuffer. When ctx is
+// cancelled the workers stop after their current pixel and Render returns
+// ctx.Err(), the image then holds every pixel that was finished.
+func (c *Camera) Render(ctx context.Context, world HittableList, sink RenderSink) (RenderResult, error) {
 	c.initialize()
 	t := time.Now()
 	tileWidth := 32
@@ -34,10 +76,19 @@ func (c *Camera) Render(world HittableList, display *DisplayBuffer, pixels []byt
 	totalTiles := numTilesX * numTilesY
 
 	tileChannel := make(chan Tile, totalTiles)
-	resultChannel := make(chan struct {
-		tile  Tile
-		color []byte
-	}, totalTiles)
+	image := NewFramebuffer(c.ImageWidth, c.imageHeight)
+	image.Stereo = c.Stereo
+	// Each finished tile leaves its splatted samples here, merged at the end
+	var filmTiles []*filmTile
+	if c.Filter.splats() {
+		filmTiles = make([]*filmTile, totalTiles)
+	}
+
+	aovs := c.renderAOVs()
+	var aovPixels []aovPixel
+	if len(aovs) > 0 {
+		aovPixels = make([]aovPixel, c.ImageWidth*c.imageHeight)
+	}
 
 	numWorkers := runtime.NumCPU() + 2
 	var wg sync.WaitGroup
@@ -48,7 +99,7 @@ func (c *Camera) Render(world HittableList, display *DisplayBuffer, pixels []byt
 	go func() {
 		for {
 			completed := completedTiles.Load()
-			if completed >= int32(totalTiles) || display.ShouldClose() {
+			if completed >= int32(totalTiles) || ctx.Err() != nil {
 				break
 			}
 
@@ -58,53 +109,40 @@ func (c *Camera) Render(world HittableList, display *DisplayBuffer, pixels []byt
 				completed, totalTiles)
 
 			// 60fps
-			display.Refresh()
+			sink.Refresh()
 			time.Sleep(time.Second / 30)
 		}
 	}()
 
 	worker := func(id int) {
 		defer wg.Done()
+		rng := NewRNG(0)
+		sampler := NewSampler(c.Sampler, c.SamplesPerPixel, c.Seed)
 
+		// Tiles never overlap, so workers write their pixels straight into the image
 		for tile := range tileChannel {
-			effectiveWidth := min(tileWidth, c.ImageWidth-tile.x)
-			effectiveHeight := min(tileHeight, c.imageHeight-tile.y)
-			tileBuffer := make([]byte, effectiveWidth*effectiveHeight*3)
-
-			for dy := 0; dy < effectiveHeight; dy++ {
-				for dx := 0; dx < effectiveWidth; dx++ {
-					if display.ShouldClose() {
+			var film *filmTile
+			if filmTiles != nil {
+				film = newFilmTile(tile, c.Filter.margin(), c.ImageWidth, c.imageHeight)
+			}
+			for y := tile.y; y < tile.y+tile.height; y++ {
+				for x := tile.x; x < tile.x+tile.width; x++ {
+					if ctx.Err() != nil {
 						return
 					}
-					x := tile.x + dx
-					y := tile.y + dy
-
-					pixelColor := Vec3{0, 0, 0}
-					for sample := 0; sample < c.SamplesPerPixel; sample++ {
-						ray := c.getRay(x, y)
-						pixelColor = pixelColor.PlusEq(rayColor(&ray, c.MaxDepth, &world, &c.Cube, c.SkipCube))
+					var aov *aovPixel
+					if aovPixels != nil {
+						aov = &aovPixels[y*c.ImageWidth+x]
 					}
+					finalColor, samples := c.samplePixel(x, y, &world, sampler, rng, aov, film)
+					image.Set(x, y, finalColor, samples)
 
-					finalColor := pixelColor.TimesConst(c.pixelSamplesScale)
-					pixelIndex := (dy*effectiveWidth + dx) * 3
-					WriteColor(tileBuffer, pixelIndex, finalColor)
-
-					toneMappedColor := ACESToneMap(finalColor)
-					intensity := Interval{0.000, 0.999}
-					display.UpdatePixel(x, y, color.RGBA{
-						R: uint8(int(256 * intensity.clamp(LinearToGamma(toneMappedColor.X)))),
-						G: uint8(int(256 * intensity.clamp(LinearToGamma(toneMappedColor.Y)))),
-						B: uint8(int(256 * intensity.clamp(LinearToGamma(toneMappedColor.Z)))),
-						A: 255,
-					})
+					sink.UpdatePixel(x, y, c.ToneMap.Color(finalColor))
 				}
 			}
-
-			resultChannel <- struct {
-				tile  Tile
-				color []byte
-			}{tile, tileBuffer}
-
+			if film != nil {
+				filmTiles[tile.index] = film
+			}
 			completedTiles.Add(1)
 		}
 	}
@@ -115,53 +153,136 @@ func (c *Camera) Render(world HittableList, display *DisplayBuffer, pixels []byt
 	}
 
 	go func() {
+		index := 0
 		for ty := 0; ty < c.imageHeight; ty += tileHeight {
 			for tx := 0; tx < c.ImageWidth; tx += tileWidth {
-				if display.ShouldClose() {
+				select {
+				case <-ctx.Done():
 					close(tileChannel)
 					return
-				}
-				tileChannel <- Tile{
+				case tileChannel <- Tile{
 					x:      tx,
 					y:      ty,
 					width:  min(tileWidth, c.ImageWidth-tx),
 					height: min(tileHeight, c.imageHeight-ty),
+					index:  index,
+				}:
 				}
+				index++
 			}
 		}
 		close(tileChannel)
 	}()
 
-	go func() {
-		for result := range resultChannel {
-			for y := 0; y < result.tile.height; y++ {
-				srcOffset := y * result.tile.width * 3
-				dstOffset := ((result.tile.y+y)*c.ImageWidth + result.tile.x) * 3
-				copy(pixels[dstOffset:], result.color[srcOffset:srcOffset+result.tile.width*3])
+	wg.Wait()
+	if filmTiles != nil {
+		resolveFilm(image, filmTiles)
+	}
+	fillAOVs(image, aovs, aovPixels)
+	result := RenderResult{Image: image, Duration: time.Since(t), TilesDone: int(completedTiles.Load()), Tiles: totalTiles}
+	if !result.Complete() {
+		fmt.Printf("Stopped after %d/%d tiles in %v\n", result.TilesDone, result.Tiles, result.Duration)
+		return result, ctx.Err()
+	}
+	//fmt.Printf("\033[1A\033[K")
+	fmt.Printf("Done in: %v\n", result.Duration)
+	return result, nil
+}
+
+// samplePixel returns the average color of pixel x, y and how many samples it
+// took, adding the first hits to aov and splatting the samples into film when
+// they aren't nil
+func (c *Camera) samplePixel(x, y int, world Hittable, sampler Sampler, rng *RNG, aov *aovPixel, film *filmTile) (Vec3, int) {
+	minSamples := c.SamplesPerPixel
+	if c.NoiseThreshold > 0 {
+		minSamples = c.MinSamples
+		if minSamples <= 0 {
+			minSamples = defaultMinSamples
+		}
+		minSamples = min(minSamples, c.SamplesPerPixel)
+	}
+
+	var stats pixelStats
+	eye := eyeBounds(c.Stereo, c.ImageWidth, c.imageHeight, x, y)
+	pixelColor := Vec3{0, 0, 0}
+	sample := 0
+	for sample < c.SamplesPerPixel {
+		rng.Seed(SampleSeed(c.Seed, x, y, sample))
+		sampler.StartPixelSample(x, y, sample)
+		ray, offset := c.getRay(x, y, sampler, rng)
+		sampleColor := c.rayColor(&ray, c.MaxDepth, world, 1, sampler).TimesConst(c.sensorScale)
+		pixelColor = pixelColor.PlusEq(sampleColor)
+		if film != nil {
+			film.addSample(c.Filter, float64(x)+0.5+offset.X, float64(y)+0.5+offset.Y, sampleColor, eye)
+		}
+		stats.add(luminance(sampleColor))
+		sample++
+		if aov != nil {
+			aov.addAOVSample(ray, world)
+		}
+
+		if sample >= minSamples && (sample-minSamples)%adaptiveBatch == 0 && stats.converged(c.NoiseThreshold) {
+			break
+		}
+	}
+	return pixelColor.TimesConst(1 / float64(sample)), sample
+}
+
+// renderAOVs are the passes to render: the requested ones and the denoiser's guides
+func (c *Camera) renderAOVs() []AOV {
+	aovs := c.AOVs
+	if c.Denoiser != nil {
+		for _, aov := range DenoiserAOVs {
+			if !slices.Contains(aovs, aov) {
+				aovs = append(slices.Clip(aovs), aov)
 			}
 		}
-	}()
+	}
+	return aovs
+}
 
-	wg.Wait()
-	close(resultChannel)
-	//fmt.Printf("\033[1A\033[K")
-	fmt.Printf("Done in: %v\n", time.Since(t))
-	return time.Since(t)
+// ImageHeight is the height of the rendered image in pixels, cube faces are
+// always square
+func (c *Camera) ImageHeight() int {
+	if c.Projection == CubeFaceProjection {
+		switch c.Stereo {
+		case StereoSideBySide:
+			return max(1, c.ImageWidth/2)
+		case StereoOverUnder:
+			return c.ImageWidth * 2
+		}
+		return c.ImageWidth
+	}
+	height := int(float64(c.ImageWidth) / c.AspectRatio)
+	if height < 1 {
+		height = 1
+	}
+	return height
 }
 
 func (c *Camera) initialize() {
-	c.imageHeight = int(float64(c.ImageWidth) / c.AspectRatio)
-	if c.imageHeight < 0 {
-		c.imageHeight = 1
-	}
+	c.imageHeight = c.ImageHeight()
 
 	c.pixelSamplesScale = 1.0 / float64(c.SamplesPerPixel)
 	c.center = c.LookFrom
 
-	theta := DegreesToRadians(c.Vfov)
+	c.eyeWidth, c.eyeHeight = c.eyeSize()
+	vfov := c.Vfov
+	c.lensRadius = c.Focusdist * math.Tan(DegreesToRadians(c.DefocusAngle/2))
+	c.sensorScale = 1
+	if c.Physical != nil {
+		vfov = c.Physical.VerticalFOV(float64(c.eyeWidth) / float64(c.eyeHeight))
+		c.lensRadius = c.Physical.ApertureRadius()
+		c.sensorScale = c.Physical.ExposureScale()
+	}
+
+	theta := DegreesToRadians(vfov)
 	h := math.Tan(theta / 2)
 	viewportHeight := 2 * h * c.Focusdist
-	viewportWidth := viewportHeight * (float64(c.ImageWidth) / float64(c.imageHeight))
+	if c.Projection == OrthographicProjection && c.OrthoHeight > 0 {
+		viewportHeight = c.OrthoHeight
+	}
+	viewportWidth := viewportHeight * (float64(c.eyeWidth) / float64(c.eyeHeight))
 
 	c.w = c.LookFrom.MinusEq(c.LookAt).UnitVector()
 	c.u = c.Vup.Cross(c.w).UnitVector()
@@ -170,39 +291,82 @@ func (c *Camera) initialize() {
 	viewportU := c.u.TimesConst(viewportWidth)
 	viewportV := c.v.Neg().TimesConst(viewportHeight)
 
-	c.pixelDeltaU = viewportU.TimesConst(1.0 / float64(c.ImageWidth))
-	c.pixelDeltaV = viewportV.TimesConst(1.0 / float64(c.imageHeight))
+	c.pixelDeltaU = viewportU.TimesConst(1.0 / float64(c.eyeWidth))
+	c.pixelDeltaV = viewportV.TimesConst(1.0 / float64(c.eyeHeight))
 
 	viewportUpperLeft := c.center.MinusEq(c.w.TimesConst(c.Focusdist)).MinusEq(viewportU.TimesConst(0.5)).MinusEq(viewportV.TimesConst(0.5))
 	c.pixel00Loc = c.pixelDeltaU.PlusEq(c.pixelDeltaV).TimesConst(0.5).PlusEq(viewportUpperLeft)
 
-	defocusRadius := c.Focusdist * math.Tan(DegreesToRadians(c.DefocusAngle/2))
-	c.defocusDiskU = c.u.TimesConst(defocusRadius)
-	c.defocusDiskV = c.v.TimesConst(defocusRadius)
+	c.defocusDiskU = c.u.TimesConst(c.lensRadius)
+	c.defocusDiskV = c.v.TimesConst(c.lensRadius)
 }
-func rayColor(r *Ray, depth int, world Hittable, cubeMap *CubeMap, SkipCube bool) Vec3 {
-	if depth <= 0 {
+
+// rayColor traces r through the world. emitWeight scales emission found by this ray,
+// which is the MIS weight when the ray was a bounce that also sampled lights.
+// Light and bounce directions come from s, everything else from r.Rng.
+func (c *Camera) rayColor(r *Ray, depth int, world Hittable, emitWeight float64, s Sampler) Vec3 {
+	if depth <= 0 || r.Direction == (Vec3{}) {
 		return Vec3{0, 0, 0}
 	}
 
 	var rec HitRecord
 
 	if world.Hit(r, Interval{0.001, math.Inf(+1)}, &rec) {
-		var scattered Ray
-		var attenuation Vec3
-		colorFromEmission := rec.Mat.ColorEmitted(rec.U, rec.V, rec.P)
+		colorFromEmission := rec.Mat.ColorEmitted(rec.U, rec.V, rec.P).TimesConst(emitWeight)
+
+		// Every bounce takes the same dimensions so they line up across samples
+		lightSample := NextPDFSample(s)
+		bounceSample := NextPDFSample(s)
+
+		mat, ok := rec.Mat.(PDFMaterial)
+		if !ok {
+			var scattered Ray
+			var attenuation Vec3
+			if !rec.Mat.Scatter(r, &scattered, &attenuation, &rec) {
+				return colorFromEmission
+			}
+			colorFromScatter := c.rayColor(&scattered, depth-1, world, 1, s).TimesEq(attenuation)
+			return colorFromEmission.PlusEq(colorFromScatter)
+		}
 
-		if rec.Mat.Scatter(r, &scattered, &attenuation, &rec) {
-			colorFromScatter := rayColor(&scattered, depth-1, world, cubeMap, SkipCube).TimesEq(attenuation)
+		var srec ScatterRecord
+		if !mat.ScatterPDF(r, &rec, &srec) {
+			return colorFromEmission
+		}
+		if srec.SkipPDF {
+			colorFromScatter := c.rayColor(&srec.SkipPDFRay, depth-1, world, 1, s).TimesEq(srec.Attenuation)
 			return colorFromEmission.PlusEq(colorFromScatter)
 		}
-		return colorFromEmission
+
+		// Sample a light directly and weight the material's own sample against it
+		var colorFromLights Vec3
+		var lights PDF
+		if len(c.Lights) > 0 {
+			lights = c.lightsPDF(rec.P, r.Rng)
+			colorFromLights = c.sampleLight(r, &rec, world, mat, &srec, lights, lightSample)
+		}
+
+		scattered := Ray{rec.P, srec.PDF.Generate(bounceSample), r.Tm, r.Rng}
+		pdfValue := srec.PDF.Value(scattered.Direction)
+		if pdfValue <= 0 {
+			return colorFromEmission.PlusEq(colorFromLights)
+		}
+		weight := 1.0
+		if lights != nil {
+			weight = powerHeuristic(pdfValue, lights.Value(scattered.Direction))
+		}
+
+		scatteringPDF := mat.ScatteringPDF(r, &rec, &scattered)
+		colorFromScatter := c.rayColor(&scattered, depth-1, world, weight, s).
+			TimesEq(srec.Attenuation).
+			TimesConst(scatteringPDF / pdfValue)
+		return colorFromEmission.PlusEq(colorFromLights).PlusEq(colorFromScatter)
 	}
 
 	// Background handling remains the same
 	unitDirection := r.Direction.Normalize()
-	if !SkipCube {
-		return cubeMap.SampleCubeMap(unitDirection)
+	if !c.SkipCube {
+		return c.Cube.SampleCubeMap(unitDirection)
 	}
 
 	a := 0.5 * (unitDirection.Y + 1.0)
@@ -213,24 +377,57 @@ func rayColor(r *Ray, depth int, world Hittable, cubeMap *CubeMap, SkipCube bool
 	return white.TimesConst(1.0 - a).PlusEq(blue.TimesConst(a))
 }
 
-func (c *Camera) getRay(i, j int) Ray {
-	offset := sampleSquare()
+// getRay returns a camera ray through pixel i, j using the pixel, lens and time
+// dimensions of s, the ray keeps rng for the rest of the path. The offset is
+// where it passes the pixel relative to its center, for the pixel filter.
+func (c *Camera) getRay(i, j int, s Sampler, rng *RNG) (Ray, Vec3) {
+	offset := sampleSquare(s.Get2D())
+	lens := s.Get2D()
+	rayTime := c.shutterTime(s.Get1D())
+	i, j, eye := c.eyePixel(i, j)
+	if c.Projection.panoramic() {
+		dir, ok := c.panoramaDirection((float64(i)+0.5+offset.X)/float64(c.eyeWidth), (float64(j)+0.5+offset.Y)/float64(c.eyeHeight))
+		if !ok {
+			// A ray without a direction stays black
+			return Ray{c.center, Vec3{}, rayTime, rng}, offset
+		}
+		origin := c.center
+		if eye != 0 {
+			origin, dir = c.odsEye(dir, eye)
+		}
+		return Ray{origin, dir, rayTime, rng}, offset
+	}
 	pixelSample := c.pixel00Loc.PlusEq(c.pixelDeltaU.TimesConst(float64(i) + offset.X)).PlusEq(c.pixelDeltaV.TimesConst(float64(j) + offset.Y))
-	var rayOrigin Vec3
-	if c.DefocusAngle <= 0 {
-		rayOrigin = c.center
-	} else {
-		rayOrigin = c.defocusDiskSample()
+	rayOrigin := c.center
+	if c.Projection == OrthographicProjection {
+		// Every pixel gets its own lens on the camera plane, the rays of all of
+		// them run parallel and still meet again at the focus distance
+		rayOrigin = pixelSample.PlusEq(c.w.TimesConst(c.Focusdist))
+	}
+	if eye != 0 {
+		rayOrigin, pixelSample = c.offAxisEye(rayOrigin, pixelSample, eye)
+	}
+	if c.lensRadius > 0 {
+		p := c.Aperture.Sample(lens)
+		// Film position with y up, the longer side going from -1 to 1
+		half := float64(max(c.eyeWidth, c.eyeHeight)) / 2
+		filmX := (float64(i) + 0.5 + offset.X - float64(c.eyeWidth)/2) / half
+		filmY := (float64(c.eyeHeight)/2 - float64(j) - 0.5 - offset.Y) / half
+		if c.Aperture.catEyeBlocked(p, filmX, filmY) {
+			return Ray{rayOrigin, Vec3{}, rayTime, rng}, offset
+		}
+		rayOrigin = rayOrigin.PlusEq(c.defocusDiskSample(p))
 	}
 	rayDirection := pixelSample.MinusEq(rayOrigin)
-	rayTime := RandomFloat()
 
-	return Ray{rayOrigin, rayDirection, rayTime}
+	return Ray{rayOrigin, rayDirection, rayTime, rng}, offset
 }
-func sampleSquare() Vec3 {
-	return Vec3{RandomFloat() - 0.5, RandomFloat() - 0.5, 0}
+func sampleSquare(u Vec2) Vec3 {
+	return Vec3{u.X - 0.5, u.Y - 0.5, 0}
 }
-func (c *Camera) defocusDiskSample() Vec3 {
-	p := RandomInUnitDisk()
-	return c.center.PlusEq(c.defocusDiskU.TimesConst(p.X)).PlusEq(c.defocusDiskV.TimesConst(p.Y))
+
+// defocusDiskSample is how far from the center of the lens the point p of the
+// aperture is
+func (c *Camera) defocusDiskSample(p Vec3) Vec3 {
+	return c.defocusDiskU.TimesConst(p.X).PlusEq(c.defocusDiskV.TimesConst(p.Y))
 }
@@ -1,28 +1,15 @@
 package utils
 
-import "math"
-
-func LinearToGamma(linearComponent float64) float64 {
-	if linearComponent > 0 {
-		return math.Sqrt(linearComponent)
+import (
+	"math"
+)
+
+// LinearToSRGB applies the sRGB transfer curve to a linear value in [0, 1]
+func LinearToSRGB(linearComponent float64) float64 {
+	if linearComponent <= 0.0031308 {
+		return 12.92 * math.Max(0, linearComponent)
 	}
-	return 0
-}
-func WriteColor(pixels []byte, index int, color Vec3) {
-	color = ACESToneMap(color)
-
-	r := LinearToGamma(color.X)
-	g := LinearToGamma(color.Y)
-	b := LinearToGamma(color.Z)
-
-	intensity := Interval{0.000, 0.999}
-	rByte := int(256 * intensity.clamp(r))
-	gByte := int(256 * intensity.clamp(g))
-	bByte := int(256 * intensity.clamp(b))
-
-	pixels[index] = byte(rByte)
-	pixels[index+1] = byte(gByte)
-	pixels[index+2] = byte(bByte)
+	return 1.055*math.Pow(linearComponent, 1/2.4) - 0.055
 }
 
 func ACESToneMap(color Vec3) Vec3 {
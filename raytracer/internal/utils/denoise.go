@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"image"
+	"math"
+	"runtime"
+	"sync/atomic"
+)
+
+// Denoiser smooths the noise out of a render with an edge avoiding à-trous
+// wavelet filter (Dammertz et al. 2010). The albedo, normal and depth AOVs
+// keep it from blurring across edges and textures, without them it can only
+// go by the colors.
+type Denoiser struct {
+	// Strength scales how different two colors may be and still get blended,
+	// higher is smoother. 0 means 1.
+	Strength float64
+	// Iterations is the number of filter passes, each one doubles the reach.
+	// 0 means 4.
+	Iterations int
+}
+
+// DenoiserAOVs are the passes Denoise uses as guides
+var DenoiserAOVs = []AOV{AOVAlbedo, AOVNormal, AOVDepth}
+
+// atrousKernel is the B3 spline, spread out further in every iteration
+var atrousKernel = [5]float64{1.0 / 16, 1.0 / 4, 3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+const (
+	denoiseSigmaColor  = 0.4  // on colors compressed to [0, 1)
+	denoiseSigmaNormal = 0.3  // on the difference of unit normals
+	denoiseSigmaAlbedo = 0.1  // on the difference of albedos
+	denoiseSigmaDepth  = 0.03 // relative to the depth of the center pixel
+)
+
+// Denoise returns a filtered copy of f, AOVs and sample counts stay the same
+func (d Denoiser) Denoise(f *Framebuffer) *Framebuffer {
+	strength := d.Strength
+	if strength <= 0 {
+		strength = 1
+	}
+	iterations := d.Iterations
+	if iterations <= 0 {
+		iterations = 4
+	}
+
+	n := f.Width * f.Height
+	albedo := f.AOVs[AOVAlbedo]
+	normal := f.AOVs[AOVNormal]
+	depth := f.AOVs[AOVDepth]
+
+	// Filter the lighting without the textures on it and put them back at the
+	// end, so texture detail isn't mistaken for noise
+	light := make([]Vec3, n)
+	modulation := make([]Vec3, n)
+	for i := range light {
+		modulation[i] = Vec3{1, 1, 1}
+		if albedo != nil {
+			modulation[i] = Vec3{
+				demodulation(albedo[i*3]),
+				demodulation(albedo[i*3+1]),
+				demodulation(albedo[i*3+2]),
+			}
+		}
+		c := f.At(i%f.Width, i/f.Width)
+		light[i] = Vec3{c.X / modulation[i].X, c.Y / modulation[i].Y, c.Z / modulation[i].Z}
+	}
+
+	next := make([]Vec3, n)
+	guide := make([]Vec3, n)
+	sigmaColor := denoiseSigmaColor * strength
+	for iteration := 0; iteration < iterations; iteration++ {
+		step := 1 << iteration
+		colorGuide(f, light, guide)
+		d.filterPass(f, light, next, guide, albedo, normal, depth, step, sigmaColor)
+		light, next = next, light
+		// Later passes only smooth what is left, keep them from eating detail
+		sigmaColor *= 0.5
+	}
+
+	out := &Framebuffer{
+		Width:   f.Width,
+		Height:  f.Height,
+		Pix:     make([]float32, len(f.Pix)),
+		Samples: f.Samples,
+		AOVs:    f.AOVs,
+		Stereo:  f.Stereo,
+	}
+	for i := range light {
+		c := light[i].TimesEq(modulation[i])
+		out.Pix[i*4] = float32(c.X)
+		out.Pix[i*4+1] = float32(c.Y)
+		out.Pix[i*4+2] = float32(c.Z)
+		out.Pix[i*4+3] = f.Pix[i*4+3]
+	}
+	return out
+}
+
+// demodulation is what a color is divided by to take the albedo off it,
+// nearly black albedos like the background are left alone
+func demodulation(albedo float32) float64 {
+	if albedo < 0.01 {
+		return 1
+	}
+	return float64(albedo)
+}
+
+// colorGuide is the compressed color slightly blurred, colors are compared on
+// it so a single firefly can't keep its neighbours from blending it away
+func colorGuide(f *Framebuffer, src, guide []Vec3) {
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			eye := eyeBounds(f.Stereo, f.Width, f.Height, x, y)
+			var sum Vec3
+			weightSum := 0.0
+			for ky := -1; ky <= 1; ky++ {
+				for kx := -1; kx <= 1; kx++ {
+					qx, qy := x+kx, y+ky
+					if !image.Pt(qx, qy).In(eye) {
+						continue
+					}
+					w := atrousKernel[kx*2+2] * atrousKernel[ky*2+2]
+					sum = sum.PlusEq(compressColor(src[qy*f.Width+qx]).TimesConst(w))
+					weightSum += w
+				}
+			}
+			guide[y*f.Width+x] = sum.TimesConst(1 / weightSum)
+		}
+	}
+}
+
+// filterPass runs one à-trous iteration from src to dst with taps step pixels apart
+func (d Denoiser) filterPass(f *Framebuffer, src, dst, guide []Vec3, albedo, normal, depth []float32, step int, sigmaColor float64) {
+	var nextRow atomic.Int32
+	worker := func() {
+		for {
+			y := int(nextRow.Add(1)) - 1
+			if y >= f.Height {
+				return
+			}
+			for x := 0; x < f.Width; x++ {
+				i := y*f.Width + x
+				if f.Pix[i*4+3] == 0 {
+					dst[i] = src[i]
+					continue
+				}
+				center := guide[i]
+				eye := eyeBounds(f.Stereo, f.Width, f.Height, x, y)
+
+				var sum Vec3
+				weightSum := 0.0
+				for ky := -2; ky <= 2; ky++ {
+					qy := y + ky*step
+					if qy < eye.Min.Y || qy >= eye.Max.Y {
+						continue
+					}
+					for kx := -2; kx <= 2; kx++ {
+						qx := x + kx*step
+						if qx < eye.Min.X || qx >= eye.Max.X {
+							continue
+						}
+						j := qy*f.Width + qx
+						if f.Pix[j*4+3] == 0 {
+							continue
+						}
+
+						w := atrousKernel[kx+2] * atrousKernel[ky+2]
+						dc := center.MinusEq(guide[j])
+						w *= math.Exp(-dc.Dot(dc) / (sigmaColor * sigmaColor))
+						if normal != nil {
+							w *= math.Exp(-squaredDistance(normal, i, j) / (denoiseSigmaNormal * denoiseSigmaNormal))
+						}
+						if albedo != nil {
+							w *= math.Exp(-squaredDistance(albedo, i, j) / (denoiseSigmaAlbedo * denoiseSigmaAlbedo))
+						}
+						if depth != nil {
+							w *= depthWeight(float64(depth[i]), float64(depth[j]))
+						}
+
+						sum = sum.PlusEq(src[j].TimesConst(w))
+						weightSum += w
+					}
+				}
+				// The center tap always has weight, so weightSum is never 0
+				dst[i] = sum.TimesConst(1 / weightSum)
+			}
+		}
+	}
+
+	workers := make([]func(), runtime.NumCPU())
+	for i := range workers {
+		workers[i] = worker
+	}
+	Parallelize(workers...)
+}
+
+// compressColor squashes HDR values into [0, 1) so a single bright sample
+// doesn't decide every color weight
+func compressColor(c Vec3) Vec3 {
+	return Vec3{c.X / (1 + c.X), c.Y / (1 + c.Y), c.Z / (1 + c.Z)}
+}
+
+func squaredDistance(data []float32, i, j int) float64 {
+	dx := float64(data[i*3] - data[j*3])
+	dy := float64(data[i*3+1] - data[j*3+1])
+	dz := float64(data[i*3+2] - data[j*3+2])
+	return dx*dx + dy*dy + dz*dz
+}
+
+func depthWeight(a, b float64) float64 {
+	if math.IsInf(a, 0) || math.IsInf(b, 0) {
+		if math.IsInf(a, 0) && math.IsInf(b, 0) {
+			return 1
+		}
+		return 0
+	}
+	return math.Exp(-math.Abs(a-b) / (denoiseSigmaDepth * math.Max(a, 1e-6)))
+}
@@ -6,6 +6,7 @@ import (
 	"golang.org/x/image/colornames"
 	"image"
 	"image/color"
+	"sync"
 )
 
 // DisplayBuffer represents the window and its associated state
@@ -13,6 +14,11 @@ type DisplayBuffer struct {
 	Win    *opengl.Window
 	canvas *image.RGBA
 	pic    *pixel.PictureData
+
+	// mu keeps Refresh from reading the canvas while render goroutines write
+	// it. Every pixel has a single writer, so writers only share the read lock
+	// with each other and Refresh takes the write lock to copy a whole frame.
+	mu sync.RWMutex
 }
 
 // NewDisplayBuffer creates a new window for displaying the raytracer output
@@ -42,12 +48,18 @@ func NewDisplayBuffer(width, height int) (*DisplayBuffer, error) {
 	}, nil
 }
 
+// UpdatePixel may be called from any goroutine, as long as no two of them
+// write the same pixel at once
 func (d *DisplayBuffer) UpdatePixel(x, y int, col color.Color) {
+	d.mu.RLock()
 	d.canvas.Set(x, y, col)
+	d.mu.RUnlock()
 }
 
 func (d *DisplayBuffer) Refresh() {
+	d.mu.Lock()
 	d.pic = pixel.PictureDataFromImage(d.canvas)
+	d.mu.Unlock()
 	sprite := pixel.NewSprite(d.pic, d.pic.Bounds())
 
 	d.Win.Clear(colornames.Black)
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// EXRPixelType is how channel values are stored in an OpenEXR file
+type EXRPixelType int32
+
+const (
+	EXRHalf  EXRPixelType = 1 // 16 bit float, plenty for colors
+	EXRFloat EXRPixelType = 2 // 32 bit float, for depth and positions
+)
+
+// EXRChannel is one named layer of values, Width*Height of them row by row.
+// Dotted names like "albedo.R" group channels into layers in compositors.
+type EXRChannel struct {
+	Name string
+	Type EXRPixelType
+	Data []float32
+}
+
+// Channels are the R, G, B and A channels of the framebuffer
+func (f *Framebuffer) Channels(t EXRPixelType) []EXRChannel {
+	channels := make([]EXRChannel, 4)
+	for c, name := range []string{"R", "G", "B", "A"} {
+		data := make([]float32, f.Width*f.Height)
+		for i := range data {
+			data[i] = f.Pix[i*4+c]
+		}
+		channels[c] = EXRChannel{Name: name, Type: t, Data: data}
+	}
+	return channels
+}
+
+// WriteEXR writes an uncompressed single part scanline OpenEXR image
+func WriteEXR(w io.Writer, width, height int, channels []EXRChannel) error {
+	if len(channels) == 0 {
+		return fmt.Errorf("exr: no channels to write")
+	}
+	for _, ch := range channels {
+		if len(ch.Data) != width*height {
+			return fmt.Errorf("exr: channel %q has %d values, expected %d", ch.Name, len(ch.Data), width*height)
+		}
+		if ch.Type != EXRHalf && ch.Type != EXRFloat {
+			return fmt.Errorf("exr: channel %q has unknown pixel type %d", ch.Name, ch.Type)
+		}
+	}
+
+	// The channel list and the scanline data have to be sorted by name
+	channels = append([]EXRChannel(nil), channels...)
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	for i := 1; i < len(channels); i++ {
+		if channels[i].Name == channels[i-1].Name {
+			return fmt.Errorf("exr: channel %q appears twice", channels[i].Name)
+		}
+	}
+
+	var header []byte
+	le := binary.LittleEndian
+	attribute := func(name, kind string, value []byte) {
+		header = append(header, name...)
+		header = append(header, 0)
+		header = append(header, kind...)
+		header = append(header, 0)
+		header = le.AppendUint32(header, uint32(len(value)))
+		header = append(header, value...)
+	}
+
+	var chlist []byte
+	lineSize := 0
+	for _, ch := range channels {
+		chlist = append(chlist, ch.Name...)
+		chlist = append(chlist, 0)
+		chlist = le.AppendUint32(chlist, uint32(ch.Type))
+		chlist = append(chlist, 0, 0, 0, 0) // pLinear and reserved
+		chlist = le.AppendUint32(chlist, 1) // x sampling
+		chlist = le.AppendUint32(chlist, 1) // y sampling
+		lineSize += width * ch.Type.size()
+	}
+	chlist = append(chlist, 0)
+
+	var box []byte
+	for _, v := range []int{0, 0, width - 1, height - 1} {
+		box = le.AppendUint32(box, uint32(int32(v)))
+	}
+
+	attribute("channels", "chlist", chlist)
+	attribute("compression", "compression", []byte{0})
+	attribute("dataWindow", "box2i", box)
+	attribute("displayWindow", "box2i", box)
+	attribute("lineOrder", "lineOrder", []byte{0})
+	attribute("pixelAspectRatio", "float", le.AppendUint32(nil, math.Float32bits(1)))
+	attribute("screenWindowCenter", "v2f", make([]byte, 8))
+	attribute("screenWindowWidth", "float", le.AppendUint32(nil, math.Float32bits(1)))
+	header = append(header, 0)
+
+	bw := bufio.NewWriter(w)
+	// Magic number and version 2 with no flags: single part scanlines
+	bw.Write([]byte{0x76, 0x2f, 0x31, 0x01, 2, 0, 0, 0})
+	bw.Write(header)
+
+	// Without compression every block is one scanline of the same size
+	offset := uint64(8 + len(header) + 8*height)
+	var scratch []byte
+	for y := 0; y < height; y++ {
+		scratch = le.AppendUint64(scratch[:0], offset+uint64(y*(8+lineSize)))
+		bw.Write(scratch)
+	}
+
+	for y := 0; y < height; y++ {
+		scratch = le.AppendUint32(scratch[:0], uint32(y))
+		scratch = le.AppendUint32(scratch, uint32(lineSize))
+		for _, ch := range channels {
+			for _, v := range ch.Data[y*width : (y+1)*width] {
+				if ch.Type == EXRHalf {
+					scratch = le.AppendUint16(scratch, floatToHalf(v))
+				} else {
+					scratch = le.AppendUint32(scratch, math.Float32bits(v))
+				}
+			}
+		}
+		if _, err := bw.Write(scratch); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (t EXRPixelType) size() int {
+	if t == EXRHalf {
+		return 2
+	}
+	return 4
+}
+
+// floatToHalf rounds f to the nearest IEEE half, too large values become infinity
+func floatToHalf(f float32) uint16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b >> 23 & 0xff)
+	mant := b & 0x7fffff
+
+	if exp == 0xff {
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	}
+
+	e := exp - 127 + 15
+	if e >= 0x1f {
+		return sign | 0x7c00
+	}
+	if e <= 0 {
+		// Subnormal half, shift the mantissa with its implicit one into place
+		if e < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - e)
+		half := mant >> shift
+		rest := mant & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if rest > halfway || (rest == halfway && half&1 != 0) {
+			half++
+		}
+		return sign | uint16(half)
+	}
+
+	// Rounding may carry into the exponent, which still gives the right value
+	half := uint32(e)<<10 | mant>>13
+	rest := mant & 0x1fff
+	if rest > 0x1000 || (rest == 0x1000 && half&1 != 0) {
+		half++
+	}
+	return sign | uint16(half)
+}
@@ -0,0 +1,362 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// halfToFloat decodes an IEEE half
+func halfToFloat(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+	switch {
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case exp == 0:
+		// Subnormal, mant * 2^-24
+		v := float32(mant) / (1 << 24)
+		if sign != 0 {
+			v = -v
+		}
+		return v
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
+func TestFloatToHalf(t *testing.T) {
+	tests := []struct {
+		in   float32
+		want uint16
+	}{
+		{0, 0x0000},
+		{float32(math.Copysign(0, -1)), 0x8000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.5, 0x3800},
+		{65504, 0x7bff},                 // largest half
+		{65520, 0x7c00},                 // rounds up to infinity
+		{1e6, 0x7c00},                   // too large
+		{float32(math.Inf(-1)), 0xfc00}, // infinity keeps its sign
+		{1.0 / (1 << 24), 0x0001},       // smallest subnormal
+		{1.0 / (1 << 26), 0x0000},       // underflows to zero
+		{1 + 1.0/2048, 0x3c00},          // halfway, rounds to even
+		{1 + 3.0/2048, 0x3c02},          // halfway, rounds to even
+		{float32(0.333333), 0x3555},
+	}
+	for _, tt := range tests {
+		if got := floatToHalf(tt.in); got != tt.want {
+			t.Errorf("floatToHalf(%v) = %#04x, want %#04x", tt.in, got, tt.want)
+		}
+	}
+	if got := floatToHalf(float32(math.NaN())); got&0x7c00 != 0x7c00 || got&0x3ff == 0 {
+		t.Errorf("floatToHalf(NaN) = %#04x, want a NaN", got)
+	}
+}
+
+// testFramebuffer fills a framebuffer with flat runs, gradients, HDR values
+// and zeros so both formats see every kind of value
+func testFramebuffer(width, height int) *Framebuffer {
+	f := NewFramebuffer(width, height)
+	rng := NewRNG(5)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var c Vec3
+			switch {
+			case x < width/3:
+				c = Vec3{0.25, 0.5, 0.75}
+			case y%2 == 0:
+				c = Vec3{float64(x) / float64(width), float64(y) * 3, 0}
+			default:
+				c = Vec3{rng.FloatInRange(0, 50), rng.Float64(), rng.FloatInRange(0, 0.01)}
+			}
+			f.Set(x, y, c, 1)
+		}
+	}
+	return f
+}
+
+type exrAttribute struct {
+	kind  string
+	value []byte
+}
+
+// readEXR parses the uncompressed scanline files WriteEXR writes
+func readEXR(data []byte) (attributes map[string]exrAttribute, channels []EXRChannel, err error) {
+	le := binary.LittleEndian
+	if !bytes.Equal(data[:8], []byte{0x76, 0x2f, 0x31, 0x01, 2, 0, 0, 0}) {
+		return nil, nil, fmt.Errorf("bad magic number and version % x", data[:8])
+	}
+	r := bytes.NewReader(data[8:])
+	br := bufio.NewReader(r)
+	attributes = map[string]exrAttribute{}
+	headerSize := 0
+	for {
+		name, err := br.ReadString(0)
+		if err != nil {
+			return nil, nil, err
+		}
+		headerSize += len(name)
+		if name == "\x00" {
+			break
+		}
+		kind, err := br.ReadString(0)
+		if err != nil {
+			return nil, nil, err
+		}
+		var size [4]byte
+		if _, err := io.ReadFull(br, size[:]); err != nil {
+			return nil, nil, err
+		}
+		value := make([]byte, le.Uint32(size[:]))
+		if _, err := io.ReadFull(br, value); err != nil {
+			return nil, nil, err
+		}
+		headerSize += len(kind) + 4 + len(value)
+		attributes[strings.TrimSuffix(name, "\x00")] = exrAttribute{strings.TrimSuffix(kind, "\x00"), value}
+	}
+
+	box := attributes["dataWindow"].value
+	width := int(int32(le.Uint32(box[8:]))) + 1
+	height := int(int32(le.Uint32(box[12:]))) + 1
+
+	chlist := attributes["channels"].value
+	for len(chlist) > 1 {
+		end := bytes.IndexByte(chlist, 0)
+		channels = append(channels, EXRChannel{
+			Name: string(chlist[:end]),
+			Type: EXRPixelType(le.Uint32(chlist[end+1:])),
+			Data: make([]float32, width*height),
+		})
+		chlist = chlist[end+1+16:]
+	}
+
+	offsets := data[8+headerSize:]
+	for y := 0; y < height; y++ {
+		block := data[le.Uint64(offsets[y*8:]):]
+		if got := int(le.Uint32(block)); got != y {
+			return nil, nil, fmt.Errorf("block %d is for scanline %d", y, got)
+		}
+		size := int(le.Uint32(block[4:]))
+		line := block[8 : 8+size]
+		for _, ch := range channels {
+			for x := 0; x < width; x++ {
+				if ch.Type == EXRHalf {
+					ch.Data[y*width+x] = halfToFloat(le.Uint16(line))
+					line = line[2:]
+				} else {
+					ch.Data[y*width+x] = math.Float32frombits(le.Uint32(line))
+					line = line[4:]
+				}
+			}
+		}
+		if len(line) != 0 {
+			return nil, nil, fmt.Errorf("scanline %d has %d bytes left over", y, len(line))
+		}
+	}
+	return attributes, channels, nil
+}
+
+func TestEXRRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		pixelType EXRPixelType
+		tolerance float64 // relative to the value
+	}{
+		{"half", EXRHalf, 1.0 / 1024},
+		{"float", EXRFloat, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := testFramebuffer(13, 7)
+			depth := make([]float32, 13*7)
+			for i := range depth {
+				depth[i] = float32(i) * 1.5
+			}
+			written := append(f.Channels(tt.pixelType), EXRChannel{Name: "depth.Z", Type: EXRFloat, Data: depth})
+
+			var buf bytes.Buffer
+			if err := WriteEXR(&buf, f.Width, f.Height, written); err != nil {
+				t.Fatal(err)
+			}
+			attributes, channels, err := readEXR(buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, kind := range map[string]string{
+				"channels": "chlist", "compression": "compression", "dataWindow": "box2i",
+				"displayWindow": "box2i", "lineOrder": "lineOrder", "pixelAspectRatio": "float",
+				"screenWindowCenter": "v2f", "screenWindowWidth": "float",
+			} {
+				if got := attributes[name].kind; got != kind {
+					t.Errorf("attribute %s has type %q, want %q", name, got, kind)
+				}
+			}
+			if got := attributes["compression"].value; !bytes.Equal(got, []byte{0}) {
+				t.Errorf("compression = %v, want none", got)
+			}
+
+			var names []string
+			for _, ch := range channels {
+				names = append(names, ch.Name)
+			}
+			if got := strings.Join(names, ","); got != "A,B,G,R,depth.Z" {
+				t.Fatalf("channels = %s, want them sorted by name", got)
+			}
+			for _, want := range written {
+				for _, got := range channels {
+					if got.Name != want.Name {
+						continue
+					}
+					if got.Type != want.Type {
+						t.Errorf("channel %s has type %d, want %d", got.Name, got.Type, want.Type)
+					}
+					for i := range want.Data {
+						// Halves keep 11 significant bits, floats are exact
+						tolerance := tt.tolerance * math.Max(1, math.Abs(float64(want.Data[i])))
+						if want.Type == EXRFloat {
+							tolerance = 0
+						}
+						if math.Abs(float64(got.Data[i]-want.Data[i])) > tolerance {
+							t.Fatalf("channel %s value %d = %v, want %v", got.Name, i, got.Data[i], want.Data[i])
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWriteEXRErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels []EXRChannel
+	}{
+		{"no channels", nil},
+		{"short channel", []EXRChannel{{Name: "R", Type: EXRHalf, Data: make([]float32, 3)}}},
+		{"unknown type", []EXRChannel{{Name: "R", Type: 7, Data: make([]float32, 4)}}},
+		{"duplicate name", []EXRChannel{
+			{Name: "depth.Z", Type: EXRFloat, Data: make([]float32, 4)},
+			{Name: "R", Type: EXRHalf, Data: make([]float32, 4)},
+			{Name: "depth.Z", Type: EXRFloat, Data: make([]float32, 4)},
+		}},
+	}
+	for _, tt := range tests {
+		if err := WriteEXR(io.Discard, 2, 2, tt.channels); err == nil {
+			t.Errorf("%s: WriteEXR returned no error", tt.name)
+		}
+	}
+}
+
+// readRGBE decodes the Radiance files WriteRGBE writes
+func readRGBE(data []byte) (width, height int, pixels []Vec3, err error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	header := []string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if line == "\n" {
+			break
+		}
+		header = append(header, strings.TrimSpace(line))
+	}
+	if len(header) < 2 || header[0] != "#?RADIANCE" || header[1] != "FORMAT=32-bit_rle_rgbe" {
+		return 0, 0, nil, fmt.Errorf("bad header %q", header)
+	}
+	if _, err := fmt.Fscanf(r, "-Y %d +X %d\n", &height, &width); err != nil {
+		return 0, 0, nil, fmt.Errorf("bad resolution line: %v", err)
+	}
+
+	line := make([]byte, width*4)
+	for y := 0; y < height; y++ {
+		if width < 8 || width > 0x7fff {
+			if _, err := io.ReadFull(r, line); err != nil {
+				return 0, 0, nil, err
+			}
+		} else {
+			var start [4]byte
+			if _, err := io.ReadFull(r, start[:]); err != nil {
+				return 0, 0, nil, err
+			}
+			if start != [4]byte{2, 2, byte(width >> 8), byte(width)} {
+				return 0, 0, nil, fmt.Errorf("scanline %d starts with % x", y, start)
+			}
+			for channel := 0; channel < 4; channel++ {
+				for x := 0; x < width; {
+					count, _ := r.ReadByte()
+					if count > 128 {
+						value, _ := r.ReadByte()
+						for n := 0; n < int(count)-128; n++ {
+							line[(x+n)*4+channel] = value
+						}
+						x += int(count) - 128
+						continue
+					}
+					if count == 0 {
+						return 0, 0, nil, fmt.Errorf("scanline %d has an empty literal run", y)
+					}
+					for n := 0; n < int(count); n++ {
+						line[(x+n)*4+channel], _ = r.ReadByte()
+					}
+					x += int(count)
+				}
+			}
+		}
+		for x := 0; x < width; x++ {
+			p := line[x*4:]
+			if p[3] == 0 {
+				pixels = append(pixels, Vec3{})
+				continue
+			}
+			scale := math.Ldexp(1, int(p[3])-128-8)
+			pixels = append(pixels, Vec3{(float64(p[0]) + 0.5) * scale, (float64(p[1]) + 0.5) * scale, (float64(p[2]) + 0.5) * scale})
+		}
+	}
+	if rest, _ := io.ReadAll(r); len(rest) != 0 {
+		return 0, 0, nil, fmt.Errorf("%d bytes after the last scanline", len(rest))
+	}
+	return width, height, pixels, nil
+}
+
+func TestRGBERoundTrip(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+	}{
+		{"flat scanlines", 5, 3},
+		{"run length encoded", 300, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := testFramebuffer(tt.width, tt.height)
+			var buf bytes.Buffer
+			if err := WriteRGBE(&buf, f); err != nil {
+				t.Fatal(err)
+			}
+			width, height, pixels, err := readRGBE(buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if width != tt.width || height != tt.height {
+				t.Fatalf("size %dx%d, want %dx%d", width, height, tt.width, tt.height)
+			}
+			for i, got := range pixels {
+				want := f.At(i%width, i/width)
+				// The shared exponent keeps 8 bits relative to the brightest channel
+				tolerance := math.Max(want.X, math.Max(want.Y, want.Z)) / 128
+				if math.Abs(got.X-want.X) > tolerance || math.Abs(got.Y-want.Y) > tolerance || math.Abs(got.Z-want.Z) > tolerance {
+					t.Fatalf("pixel %d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+type FilterType int
+
+const (
+	BoxFilter      FilterType = iota // every sample counts the same, the classic per pixel average
+	TentFilter                       // weight falls off linearly with distance
+	GaussianFilter                   // smooth falloff, slightly soft
+	MitchellFilter                   // Mitchell-Netravali with B = C = 1/3, sharp with little ringing
+)
+
+var filterNames = map[FilterType]string{
+	BoxFilter:      "box",
+	TentFilter:     "tent",
+	GaussianFilter: "gaussian",
+	MitchellFilter: "mitchell",
+}
+
+func (t FilterType) String() string {
+	if name, ok := filterNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("FilterType(%d)", int(t))
+}
+
+func ParseFilterType(name string) (FilterType, error) {
+	for t, n := range filterNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown filter %q, expected box, tent, gaussian or mitchell", name)
+}
+
+// PixelFilter decides how much a sample adds to each pixel around it. The
+// zero value is a box over the pixel, which is a plain average.
+type PixelFilter struct {
+	Type FilterType
+	// Radius in pixels, at least 0.5 for box. 0 picks 0.5 for box, 1 for
+	// tent, 1.5 for gaussian and 2 for mitchell.
+	Radius float64
+}
+
+func (f PixelFilter) radius() float64 {
+	if f.Radius > 0 {
+		return f.Radius
+	}
+	switch f.Type {
+	case TentFilter:
+		return 1
+	case GaussianFilter:
+		return 1.5
+	case MitchellFilter:
+		return 2
+	}
+	return 0.5
+}
+
+// Evaluate is the weight of a sample dx, dy pixels away from a pixel center
+func (f PixelFilter) Evaluate(dx, dy float64) float64 {
+	return f.evaluate1D(dx, f.radius()) * f.evaluate1D(dy, f.radius())
+}
+
+func (f PixelFilter) evaluate1D(d, r float64) float64 {
+	d = math.Abs(d)
+	if d > r {
+		return 0
+	}
+	switch f.Type {
+	case TentFilter:
+		return r - d
+	case GaussianFilter:
+		// pbrt's gaussian with alpha 2 at radius 1.5, shifted to reach 0 at the radius
+		alpha := 2 * (1.5 / r) * (1.5 / r)
+		return math.Max(0, math.Exp(-alpha*d*d)-math.Exp(-alpha*r*r))
+	case MitchellFilter:
+		return mitchell(2 * d / r)
+	}
+	return 1
+}
+
+// mitchell is the Mitchell-Netravali cubic on [0, 2]
+func mitchell(x float64) float64 {
+	const b, c = 1.0 / 3, 1.0 / 3
+	if x > 1 {
+		return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+	}
+	return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+}
+
+// splats reports whether samples reach past their own pixel, a box of
+// radius 0.5 doesn't need any splatting
+func (f PixelFilter) splats() bool {
+	return f.Type != BoxFilter || f.radius() > 0.5
+}
+
+// margin is how many pixels past its own a sample can reach
+func (f PixelFilter) margin() int {
+	return max(0, int(math.Ceil(f.radius()-0.5)))
+}
+
+// minFilterWeight is the total filter weight below which a pixel's negative
+// lobes are taken to have cancelled out its samples, it then shows the plain
+// average of its own samples instead
+const minFilterWeight = 1e-9
+
+// filmTile collects the filtered samples of one tile. It is padded by the
+// filter's reach so samples can land in the neighbouring tiles' pixels, and
+// only merged into the image once the tile is finished.
+type filmTile struct {
+	x0, y0, width, height int
+	sum                   []Vec3
+	weight                []float64
+}
+
+func newFilmTile(tile Tile, margin, imageWidth, imageHeight int) *filmTile {
+	x0 := max(0, tile.x-margin)
+	y0 := max(0, tile.y-margin)
+	x1 := min(imageWidth, tile.x+tile.width+margin)
+	y1 := min(imageHeight, tile.y+tile.height+margin)
+	return &filmTile{
+		x0:     x0,
+		y0:     y0,
+		width:  x1 - x0,
+		height: y1 - y0,
+		sum:    make([]Vec3, (x1-x0)*(y1-y0)),
+		weight: make([]float64, (x1-x0)*(y1-y0)),
+	}
+}
+
+// addSample splats a sample taken at image position px, py (pixel x covers
+// x to x+1) into every pixel of the tile the filter reaches, as long as it
+// lies in eye, the part of the image the sample's pixel belongs to
+func (t *filmTile) addSample(f PixelFilter, px, py float64, c Vec3, eye image.Rectangle) {
+	r := f.radius()
+	xMin := max(t.x0, eye.Min.X, int(math.Ceil(px-0.5-r)))
+	xMax := min(t.x0+t.width, eye.Max.X, int(math.Floor(px-0.5+r))+1) - 1
+	yMin := max(t.y0, eye.Min.Y, int(math.Ceil(py-0.5-r)))
+	yMax := min(t.y0+t.height, eye.Max.Y, int(math.Floor(py-0.5+r))+1) - 1
+	for y := yMin; y <= yMax; y++ {
+		for x := xMin; x <= xMax; x++ {
+			w := f.Evaluate(float64(x)+0.5-px, float64(y)+0.5-py)
+			if w == 0 {
+				continue
+			}
+			i := (y-t.y0)*t.width + (x - t.x0)
+			t.sum[i] = t.sum[i].PlusEq(c.TimesConst(w))
+			t.weight[i] += w
+		}
+	}
+}
+
+// resolveFilm merges the finished tiles in tile order, so the result doesn't
+// depend on which worker finished first, and stores the filtered colors of
+// the rendered pixels in image
+func resolveFilm(image *Framebuffer, tiles []*filmTile) {
+	sum := make([]Vec3, image.Width*image.Height)
+	weight := make([]float64, image.Width*image.Height)
+	for _, t := range tiles {
+		if t == nil {
+			continue
+		}
+		for y := 0; y < t.height; y++ {
+			for x := 0; x < t.width; x++ {
+				i := y*t.width + x
+				j := (t.y0+y)*image.Width + t.x0 + x
+				sum[j] = sum[j].PlusEq(t.sum[i])
+				weight[j] += t.weight[i]
+			}
+		}
+	}
+
+	for y := 0; y < image.Height; y++ {
+		for x := 0; x < image.Width; x++ {
+			i := y*image.Width + x
+			if image.Alpha(x, y) == 0 || weight[i] <= minFilterWeight {
+				continue
+			}
+			image.Set(x, y, sum[i].TimesConst(1/weight[i]), int(image.Samples[i]))
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestFilterWeights(t *testing.T) {
+	gaussianPeak := 1 - math.Exp(-4.5)
+	tests := []struct {
+		name   string
+		filter PixelFilter
+		d      float64
+		want   float64
+	}{
+		{"box center", PixelFilter{}, 0, 1},
+		{"box edge", PixelFilter{}, 0.5, 1},
+		{"box outside", PixelFilter{}, 0.6, 0},
+		{"wide box", PixelFilter{Type: BoxFilter, Radius: 1.5}, 1.4, 1},
+		{"tent center", PixelFilter{Type: TentFilter}, 0, 1},
+		{"tent half way", PixelFilter{Type: TentFilter}, 0.5, 0.5},
+		{"tent radius", PixelFilter{Type: TentFilter}, 1, 0},
+		{"tent outside", PixelFilter{Type: TentFilter}, 1.5, 0},
+		{"wide tent", PixelFilter{Type: TentFilter, Radius: 2}, 1, 1},
+		{"gaussian center", PixelFilter{Type: GaussianFilter}, 0, gaussianPeak},
+		{"gaussian radius", PixelFilter{Type: GaussianFilter}, 1.5, 0},
+		{"gaussian outside", PixelFilter{Type: GaussianFilter}, 3, 0},
+		{"mitchell center", PixelFilter{Type: MitchellFilter}, 0, 16.0 / 18},
+		{"mitchell one", PixelFilter{Type: MitchellFilter}, 1, 1.0 / 18},
+		{"mitchell radius", PixelFilter{Type: MitchellFilter}, 2, 0},
+		{"mitchell outside", PixelFilter{Type: MitchellFilter}, 2.5, 0},
+	}
+	for _, tt := range tests {
+		f := tt.filter
+		if got := f.evaluate1D(tt.d, f.radius()); !nearlyEqual(got, tt.want, 1e-12) {
+			t.Errorf("%s: weight at %v = %v, want %v", tt.name, tt.d, got, tt.want)
+		}
+		// The 2D weight is separable and symmetric
+		peak := f.evaluate1D(0, f.radius())
+		for _, d := range [][2]float64{{tt.d, 0}, {-tt.d, 0}, {0, tt.d}, {0, -tt.d}} {
+			if got := f.Evaluate(d[0], d[1]); !nearlyEqual(got, tt.want*peak, 1e-12) {
+				t.Errorf("%s: Evaluate(%v, %v) = %v, want %v", tt.name, d[0], d[1], got, tt.want*peak)
+			}
+		}
+	}
+
+	// Mitchell's negative lobe sits between one pixel and the radius
+	mitchell := PixelFilter{Type: MitchellFilter}
+	for _, d := range []float64{1.2, 1.5, 1.8} {
+		if w := mitchell.evaluate1D(d, mitchell.radius()); w >= 0 {
+			t.Errorf("mitchell weight at %v = %v, want it negative", d, w)
+		}
+	}
+}
+
+func TestFilterMargin(t *testing.T) {
+	tests := []struct {
+		filter PixelFilter
+		splats bool
+		margin int
+	}{
+		{PixelFilter{}, false, 0},
+		{PixelFilter{Type: BoxFilter, Radius: 1}, true, 1},
+		{PixelFilter{Type: TentFilter}, true, 1},
+		{PixelFilter{Type: GaussianFilter}, true, 1},
+		{PixelFilter{Type: MitchellFilter}, true, 2},
+		{PixelFilter{Type: MitchellFilter, Radius: 3}, true, 3},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.splats(); got != tt.splats {
+			t.Errorf("%v radius %v: splats = %v, want %v", tt.filter.Type, tt.filter.Radius, got, tt.splats)
+		}
+		if got := tt.filter.margin(); got != tt.margin {
+			t.Errorf("%v radius %v: margin = %d, want %d", tt.filter.Type, tt.filter.Radius, got, tt.margin)
+		}
+	}
+}
+
+// renderedFramebuffer is a framebuffer whose pixels all count as rendered
+func renderedFramebuffer(width, height int) *Framebuffer {
+	f := NewFramebuffer(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			f.Set(x, y, Vec3{}, 1)
+		}
+	}
+	return f
+}
+
+type filmSample struct {
+	px, py float64
+	c      Vec3
+}
+
+func randomFilmSamples(rng *RNG, width, height, n int) []filmSample {
+	samples := make([]filmSample, n)
+	for i := range samples {
+		samples[i] = filmSample{
+			px: rng.FloatInRange(0, float64(width)),
+			py: rng.FloatInRange(0, float64(height)),
+			c:  Vec3{rng.Float64(), rng.Float64(), rng.Float64()},
+		}
+	}
+	return samples
+}
+
+// TestFilmTilesSplitEvenly checks splitting the image into tiles doesn't
+// change the result, samples near a tile edge must still reach the pixels
+// of the tile next door
+func TestFilmTilesSplitEvenly(t *testing.T) {
+	const width, height = 16, 8
+	full := image.Rect(0, 0, width, height)
+	for _, filter := range []PixelFilter{
+		{Type: BoxFilter, Radius: 1},
+		{Type: TentFilter},
+		{Type: GaussianFilter},
+		{Type: MitchellFilter},
+	} {
+		samples := randomFilmSamples(NewRNG(3), width, height, 2000)
+		margin := filter.margin()
+
+		one := newFilmTile(Tile{0, 0, width, height, 0}, margin, width, height)
+		for _, s := range samples {
+			one.addSample(filter, s.px, s.py, s.c, full)
+		}
+		oneImage := renderedFramebuffer(width, height)
+		resolveFilm(oneImage, []*filmTile{one})
+
+		tiles := []Tile{{0, 0, width / 2, height, 0}, {width / 2, 0, width / 2, height, 1}}
+		two := []*filmTile{
+			newFilmTile(tiles[0], margin, width, height),
+			newFilmTile(tiles[1], margin, width, height),
+		}
+		for _, s := range samples {
+			// A sample belongs to the tile its pixel is in
+			i := 0
+			if int(s.px) >= width/2 {
+				i = 1
+			}
+			two[i].addSample(filter, s.px, s.py, s.c, full)
+		}
+		twoImage := renderedFramebuffer(width, height)
+		resolveFilm(twoImage, two)
+
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				if !vecNearlyEqual(oneImage.At(x, y), twoImage.At(x, y), 1e-9) {
+					t.Fatalf("%v: pixel %d,%d is %v with two tiles, %v with one", filter.Type, x, y, twoImage.At(x, y), oneImage.At(x, y))
+				}
+			}
+		}
+	}
+}
+
+// TestFilmStereoSeam checks samples don't bleed across the seam between
+// the two eyes of a side by side image
+func TestFilmStereoSeam(t *testing.T) {
+	const width, height = 16, 4
+	filter := PixelFilter{Type: GaussianFilter, Radius: 3}
+	tile := newFilmTile(Tile{0, 0, width, height, 0}, filter.margin(), width, height)
+	left := eyeBounds(StereoSideBySide, width, height, 7, 2)
+	right := eyeBounds(StereoSideBySide, width, height, 8, 2)
+	tile.addSample(filter, 7.9, 2, Vec3{1, 0, 0}, left)
+	tile.addSample(filter, 8.1, 2, Vec3{0, 0, 1}, right)
+
+	f := renderedFramebuffer(width, height)
+	resolveFilm(f, []*filmTile{tile})
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := f.At(x, y)
+			if x < width/2 && c.Z != 0 || x >= width/2 && c.X != 0 {
+				t.Errorf("pixel %d,%d = %v, the other eye's sample leaked in", x, y, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package utils
+
+// Framebuffer is the linear HDR result of a render. Colors stay unclamped
+// radiance, a ToneMapper turns them into 8 bit only to show or save them.
+type Framebuffer struct {
+	Width, Height int
+	// Pix holds RGBA float32 values row by row from the top. Alpha is 1 for
+	// rendered pixels and 0 for the ones a cancelled render never reached.
+	Pix []float32
+	// Samples is how many samples went into each pixel
+	Samples []int32
+	// AOVs holds the auxiliary passes the camera asked for, with
+	// len(aov.Channels()) values per pixel
+	AOVs map[AOV][]float32
+	// Stereo is how the image is split between two eyes, filters never
+	// reach from one eye into the other
+	Stereo StereoMode
+}
+
+func NewFramebuffer(width, height int) *Framebuffer {
+	return &Framebuffer{
+		Width:   width,
+		Height:  height,
+		Pix:     make([]float32, width*height*4),
+		Samples: make([]int32, width*height),
+	}
+}
+
+// At is the linear color of pixel x, y
+func (f *Framebuffer) At(x, y int) Vec3 {
+	i := (y*f.Width + x) * 4
+	return Vec3{float64(f.Pix[i]), float64(f.Pix[i+1]), float64(f.Pix[i+2])}
+}
+
+// Alpha is 0 for pixels that were never rendered
+func (f *Framebuffer) Alpha(x, y int) float32 {
+	return f.Pix[(y*f.Width+x)*4+3]
+}
+
+// Set stores the linear color of pixel x, y and how many samples it took
+func (f *Framebuffer) Set(x, y int, c Vec3, samples int) {
+	i := (y*f.Width + x) * 4
+	f.Pix[i] = float32(c.X)
+	f.Pix[i+1] = float32(c.Y)
+	f.Pix[i+2] = float32(c.Z)
+	f.Pix[i+3] = 1
+	f.Samples[y*f.Width+x] = int32(samples)
+}
+
+// AverageSamples is the mean number of samples per pixel
+func (f *Framebuffer) AverageSamples() float64 {
+	total := 0
+	for _, n := range f.Samples {
+		total += int(n)
+	}
+	return float64(total) / float64(max(len(f.Samples), 1))
+}
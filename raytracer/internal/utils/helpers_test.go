@@ -0,0 +1,57 @@
+package utils
+
+import "math"
+
+// testSphere is a bare sphere for tests, the real one lives in the objects
+// package which imports this one
+type testSphere struct {
+	center Vec3
+	radius float64
+}
+
+func (s testSphere) BoundingBox() AABB {
+	r := Vec3{s.radius, s.radius, s.radius}
+	return NewAABBFromPoints(s.center.MinusEq(r), s.center.PlusEq(r))
+}
+
+func (s testSphere) Hit(r *Ray, rayT Interval, rec *HitRecord) bool {
+	oc := s.center.MinusEq(r.Origin)
+	a := r.Direction.LengthSquared()
+	h := r.Direction.Dot(oc)
+	c := oc.LengthSquared() - s.radius*s.radius
+	discriminant := h*h - a*c
+	if discriminant < 0 {
+		return false
+	}
+	root := (h - math.Sqrt(discriminant)) / a
+	if !rayT.Surrounds(root) {
+		root = (h + math.Sqrt(discriminant)) / a
+		if !rayT.Surrounds(root) {
+			return false
+		}
+	}
+	rec.T = root
+	rec.P = r.At(root)
+	rec.SetFaceNormal(r, rec.P.MinusEq(s.center).TimesConst(1/s.radius))
+	return true
+}
+
+// randomSpheres scatters n spheres through a box 20 units wide
+func randomSpheres(rng *RNG, n int) []Hittable {
+	spheres := make([]Hittable, n)
+	for i := range spheres {
+		spheres[i] = testSphere{
+			center: Vec3{rng.FloatInRange(-10, 10), rng.FloatInRange(-10, 10), rng.FloatInRange(-10, 10)},
+			radius: rng.FloatInRange(0.1, 1.5),
+		}
+	}
+	return spheres
+}
+
+func nearlyEqual(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
+
+func vecNearlyEqual(a, b Vec3, tolerance float64) bool {
+	return nearlyEqual(a.X, b.X, tolerance) && nearlyEqual(a.Y, b.Y, tolerance) && nearlyEqual(a.Z, b.Z, tolerance)
+}
@@ -5,6 +5,7 @@ type HitRecord struct {
 	T, U, V   float64
 	FrontFace bool
 	Mat       Material
+	ObjectID  int32 // set by Tagged for the object ID pass
 }
 
 func (h *HitRecord) SetFaceNormal(r *Ray, outwardNormal Vec3) {
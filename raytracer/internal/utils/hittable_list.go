@@ -14,8 +14,13 @@ func (h *HittableList) BoundingBox() AABB {
 }
 
 func (h *HittableList) Add(object Hittable) {
+	// The zero Box would otherwise pull the origin into every list's bounds
+	if len(h.Objects) == 0 {
+		h.Box = object.BoundingBox()
+	} else {
+		h.Box = SurroundingBox(h.Box, object.BoundingBox())
+	}
 	h.Objects = append(h.Objects, object)
-	h.Box = SurroundingBox(h.Box, object.BoundingBox())
 }
 func (h *HittableList) Clear() {
 	h.Objects = nil
@@ -0,0 +1,29 @@
+package utils
+
+// Instance places shared geometry, usually a mesh BVH, in the world. Any number of
+// instances can point at the same Object so memory only grows with unique meshes,
+// and the world BVH built over the instances forms the top level of a two level tree.
+type Instance struct {
+	Transform
+
+	// Material replaces the geometry's own materials when it is not nil
+	Material Material
+}
+
+func NewInstance(geometry Hittable, objectToWorld Mat4, mat Material) (*Instance, error) {
+	t, err := NewTransform(geometry, objectToWorld)
+	if err != nil {
+		return nil, err
+	}
+	return &Instance{Transform: *t, Material: mat}, nil
+}
+
+func (i *Instance) Hit(r *Ray, rayT Interval, rec *HitRecord) bool {
+	if !i.Transform.Hit(r, rayT, rec) {
+		return false
+	}
+	if i.Material != nil {
+		rec.Mat = i.Material
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package utils
+
+import "math"
+
+// Light is an emissive primitive the renderer can sample directly (next event estimation)
+type Light interface {
+	Hittable
+
+	// PDFValue is the solid angle density of Random producing direction from
+	// origin. Rays it traces to find out take their random numbers from rng.
+	PDFValue(origin, direction Vec3, rng *RNG) float64
+
+	// Random warps u into a direction from origin towards a point on the light
+	Random(origin Vec3, u Vec2) Vec3
+}
+
+// lightsPDF picks one of the camera's lights uniformly and samples a direction
+// towards it, rng is the random number generator of the path it is sampled for
+func (c *Camera) lightsPDF(origin Vec3, rng *RNG) PDF {
+	if len(c.Lights) == 1 {
+		return HittablePDF{Object: c.Lights[0], Origin: origin, Rng: rng}
+	}
+	pdfs := make([]PDF, len(c.Lights))
+	for i, light := range c.Lights {
+		pdfs[i] = HittablePDF{Object: light, Origin: origin, Rng: rng}
+	}
+	return NewMixturePDF(pdfs...)
+}
+
+// powerHeuristic is Veach's MIS weight for a sample drawn with pdf a competing against pdf b
+func powerHeuristic(a, b float64) float64 {
+	a2 := a * a
+	b2 := b * b
+	if a2+b2 == 0 || math.IsInf(a2, 1) {
+		return 1
+	}
+	return a2 / (a2 + b2)
+}
+
+// sampleLight returns the MIS weighted light reaching rec directly from one light sample
+func (c *Camera) sampleLight(r *Ray, rec *HitRecord, world Hittable, mat PDFMaterial, srec *ScatterRecord, lights PDF, u PDFSample) Vec3 {
+	direction := lights.Generate(u)
+	lightPDF := lights.Value(direction)
+	if lightPDF <= 0 {
+		return Vec3{}
+	}
+
+	shadowRay := Ray{rec.P, direction, r.Tm, r.Rng}
+	scatteringPDF := mat.ScatteringPDF(r, rec, &shadowRay)
+	if scatteringPDF <= 0 {
+		return Vec3{}
+	}
+
+	var lightRec HitRecord
+	if !world.Hit(&shadowRay, Interval{0.001, math.Inf(+1)}, &lightRec) {
+		return Vec3{}
+	}
+	emitted := lightRec.Mat.ColorEmitted(lightRec.U, lightRec.V, lightRec.P)
+	if emitted.NearZero() {
+		return Vec3{}
+	}
+
+	weight := powerHeuristic(lightPDF, srec.PDF.Value(direction))
+	return emitted.TimesEq(srec.Attenuation).TimesConst(scatteringPDF * weight / lightPDF)
+}
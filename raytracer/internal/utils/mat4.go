@@ -0,0 +1,158 @@
+package utils
+
+import "math"
+
+// Mat4 is a row major 4x4 matrix used for affine transforms, points are columns
+// so a.Mul(b) applies b first and then a
+type Mat4 [4][4]float64
+
+func Identity() Mat4 {
+	return Mat4{
+		{1, 0, 0, 0},
+		{0, 1, 0, 0},
+		{0, 0, 1, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+func Translation(offset Vec3) Mat4 {
+	m := Identity()
+	m[0][3] = offset.X
+	m[1][3] = offset.Y
+	m[2][3] = offset.Z
+	return m
+}
+
+func Scaling(s Vec3) Mat4 {
+	m := Identity()
+	m[0][0] = s.X
+	m[1][1] = s.Y
+	m[2][2] = s.Z
+	return m
+}
+
+// RotationX rotates counterclockwise around the X axis, angles are in degrees like Vfov
+func RotationX(degrees float64) Mat4 {
+	sin, cos := math.Sincos(DegreesToRadians(degrees))
+	m := Identity()
+	m[1][1], m[1][2] = cos, -sin
+	m[2][1], m[2][2] = sin, cos
+	return m
+}
+
+func RotationY(degrees float64) Mat4 {
+	sin, cos := math.Sincos(DegreesToRadians(degrees))
+	m := Identity()
+	m[0][0], m[0][2] = cos, sin
+	m[2][0], m[2][2] = -sin, cos
+	return m
+}
+
+func RotationZ(degrees float64) Mat4 {
+	sin, cos := math.Sincos(DegreesToRadians(degrees))
+	m := Identity()
+	m[0][0], m[0][1] = cos, -sin
+	m[1][0], m[1][1] = sin, cos
+	return m
+}
+
+// LookAtMatrix places an object at from with its +Z axis pointing at at
+func LookAtMatrix(from, at, up Vec3) Mat4 {
+	w := at.MinusEq(from).UnitVector()
+	u := up.Cross(w).UnitVector()
+	v := w.Cross(u)
+	return Mat4{
+		{u.X, v.X, w.X, from.X},
+		{u.Y, v.Y, w.Y, from.Y},
+		{u.Z, v.Z, w.Z, from.Z},
+		{0, 0, 0, 1},
+	}
+}
+
+func (m Mat4) Mul(o Mat4) Mat4 {
+	var r Mat4
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			for k := 0; k < 4; k++ {
+				r[i][j] += m[i][k] * o[k][j]
+			}
+		}
+	}
+	return r
+}
+
+func (m Mat4) Transpose() Mat4 {
+	var r Mat4
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			r[i][j] = m[j][i]
+		}
+	}
+	return r
+}
+
+// TransformPoint applies the full transform including translation
+func (m Mat4) TransformPoint(p Vec3) Vec3 {
+	return Vec3{
+		m[0][0]*p.X + m[0][1]*p.Y + m[0][2]*p.Z + m[0][3],
+		m[1][0]*p.X + m[1][1]*p.Y + m[1][2]*p.Z + m[1][3],
+		m[2][0]*p.X + m[2][1]*p.Y + m[2][2]*p.Z + m[2][3],
+	}
+}
+
+// TransformVector ignores translation, use it for directions
+func (m Mat4) TransformVector(v Vec3) Vec3 {
+	return Vec3{
+		m[0][0]*v.X + m[0][1]*v.Y + m[0][2]*v.Z,
+		m[1][0]*v.X + m[1][1]*v.Y + m[1][2]*v.Z,
+		m[2][0]*v.X + m[2][1]*v.Y + m[2][2]*v.Z,
+	}
+}
+
+// Inverse of an affine matrix, ok is false when it is singular
+func (m Mat4) Inverse() (inv Mat4, ok bool) {
+	// Invert the 3x3 linear part with the adjugate, then undo the translation
+	a := m
+	det := a[0][0]*(a[1][1]*a[2][2]-a[1][2]*a[2][1]) -
+		a[0][1]*(a[1][0]*a[2][2]-a[1][2]*a[2][0]) +
+		a[0][2]*(a[1][0]*a[2][1]-a[1][1]*a[2][0])
+	if math.Abs(det) < 1e-12 {
+		return Identity(), false
+	}
+	invDet := 1 / det
+
+	inv[0][0] = (a[1][1]*a[2][2] - a[1][2]*a[2][1]) * invDet
+	inv[0][1] = (a[0][2]*a[2][1] - a[0][1]*a[2][2]) * invDet
+	inv[0][2] = (a[0][1]*a[1][2] - a[0][2]*a[1][1]) * invDet
+	inv[1][0] = (a[1][2]*a[2][0] - a[1][0]*a[2][2]) * invDet
+	inv[1][1] = (a[0][0]*a[2][2] - a[0][2]*a[2][0]) * invDet
+	inv[1][2] = (a[0][2]*a[1][0] - a[0][0]*a[1][2]) * invDet
+	inv[2][0] = (a[1][0]*a[2][1] - a[1][1]*a[2][0]) * invDet
+	inv[2][1] = (a[0][1]*a[2][0] - a[0][0]*a[2][1]) * invDet
+	inv[2][2] = (a[0][0]*a[1][1] - a[0][1]*a[1][0]) * invDet
+
+	t := inv.TransformVector(Vec3{a[0][3], a[1][3], a[2][3]})
+	inv[0][3], inv[1][3], inv[2][3] = -t.X, -t.Y, -t.Z
+	inv[3][3] = 1
+	return inv, true
+}
+
+// TransformBox returns the world box around the transformed corners of box
+func (m Mat4) TransformBox(box AABB) AABB {
+	result := EmptyAABB
+	for i := 0; i < 8; i++ {
+		corner := Vec3{box.X.Min, box.Y.Min, box.Z.Min}
+		if i&1 != 0 {
+			corner.X = box.X.Max
+		}
+		if i&2 != 0 {
+			corner.Y = box.Y.Max
+		}
+		if i&4 != 0 {
+			corner.Z = box.Z.Max
+		}
+		result.ExpandToPoint(m.TransformPoint(corner))
+	}
+	result.PadToMinimums()
+	return result
+}
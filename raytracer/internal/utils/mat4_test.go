@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMat4Inverse(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Mat4
+		ok   bool
+	}{
+		{"identity", Identity(), true},
+		{"translation", Translation(Vec3{3, -2, 7}), true},
+		{"scaling", Scaling(Vec3{2, 0.5, -4}), true},
+		{"rotation x", RotationX(33), true},
+		{"rotation y", RotationY(-120), true},
+		{"rotation z", RotationZ(270), true},
+		{"composed", Translation(Vec3{265, 0, 295}).Mul(RotationY(15)).Mul(Scaling(Vec3{1, 3, 0.2})), true},
+		{"look at", LookAtMatrix(Vec3{1, 2, 3}, Vec3{-4, 0, 8}, Vec3{0, 1, 0}), true},
+		{"flat", Scaling(Vec3{1, 0, 1}), false},
+		{"collapsed axes", Mat4{{1, 2, 3, 0}, {2, 4, 6, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv, ok := tt.m.Inverse()
+			if ok != tt.ok {
+				t.Fatalf("Inverse() ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			for _, product := range []Mat4{tt.m.Mul(inv), inv.Mul(tt.m)} {
+				for i := 0; i < 4; i++ {
+					for j := 0; j < 4; j++ {
+						if want := Identity()[i][j]; math.Abs(product[i][j]-want) > 1e-9 {
+							t.Fatalf("m * inverse = %v, want the identity", product)
+						}
+					}
+				}
+			}
+			p := Vec3{0.3, -1.7, 2.2}
+			if got := inv.TransformPoint(tt.m.TransformPoint(p)); !vecNearlyEqual(got, p, 1e-9) {
+				t.Errorf("inverse(m(p)) = %v, want %v", got, p)
+			}
+		})
+	}
+}
+
+// TestTransformNormals checks hits on a transformed unit sphere land on its
+// surface with unit normals perpendicular to it, facing the ray
+func TestTransformNormals(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Mat4
+	}{
+		{"translated", Translation(Vec3{1, 2, 3})},
+		{"rotated", RotationX(40).Mul(RotationZ(-25))},
+		{"uniform scale", Scaling(Vec3{3, 3, 3})},
+		{"ellipsoid", Translation(Vec3{-2, 0, 5}).Mul(RotationY(30)).Mul(Scaling(Vec3{4, 0.5, 2}))},
+		{"mirrored", Scaling(Vec3{-1, 2, 1})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transform, err := NewTransform(testSphere{radius: 1}, tt.m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			inv, _ := tt.m.Inverse()
+			center := tt.m.TransformPoint(Vec3{})
+			rng := NewRNG(8)
+			for i := 0; i < 500; i++ {
+				origin := center.PlusEq(rng.UnitVector().TimesConst(20))
+				target := center.PlusEq(rng.UnitVector().TimesConst(0.2))
+				ray := Ray{Origin: origin, Direction: target.MinusEq(origin)}
+				var rec HitRecord
+				if !transform.Hit(&ray, Interval{0.001, math.Inf(1)}, &rec) {
+					t.Fatalf("ray %d towards the center missed", i)
+				}
+
+				q := inv.TransformPoint(rec.P)
+				if !nearlyEqual(q.Length(), 1, 1e-9) {
+					t.Fatalf("hit %v is not on the surface, object space distance %v", rec.P, q.Length())
+				}
+				if !nearlyEqual(rec.Normal.Length(), 1, 1e-9) {
+					t.Fatalf("normal %v is not unit length", rec.Normal)
+				}
+				tangent1 := q.Cross(Vec3{0, 1, 0})
+				if tangent1.NearZero() {
+					tangent1 = q.Cross(Vec3{1, 0, 0})
+				}
+				tangent2 := q.Cross(tangent1)
+				for _, tangent := range []Vec3{tangent1, tangent2} {
+					worldTangent := tt.m.TransformVector(tangent).UnitVector()
+					if d := rec.Normal.Dot(worldTangent); math.Abs(d) > 1e-9 {
+						t.Fatalf("normal %v is not perpendicular to the surface at %v, dot %v", rec.Normal, rec.P, d)
+					}
+				}
+				if !rec.FrontFace || rec.Normal.Dot(ray.Direction) >= 0 {
+					t.Fatalf("normal %v of an outside hit does not face the ray", rec.Normal)
+				}
+			}
+		})
+	}
+}
+
+func TestNewTransformSingular(t *testing.T) {
+	if _, err := NewTransform(testSphere{radius: 1}, Scaling(Vec3{1, 1, 0})); err == nil {
+		t.Error("NewTransform with a flat matrix returned no error")
+	}
+	if _, err := NewInstance(testSphere{radius: 1}, Scaling(Vec3{0, 1, 1}), nil); err == nil {
+		t.Error("NewInstance with a flat matrix returned no error")
+	}
+}
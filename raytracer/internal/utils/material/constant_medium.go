@@ -48,7 +48,7 @@ func (cm *ConstantMedium) Hit(r *utils.Ray, rayT utils.Interval, rec *utils.HitR
 
 	rayLength := r.Direction.Length()
 	distanceInsideBoundary := (rec2.T - rec1.T) * rayLength
-	hitDistance := cm.NegInvDensity * math.Log(utils.RandomFloat())
+	hitDistance := cm.NegInvDensity * math.Log(r.Rng.Float64())
 
 	if hitDistance > distanceInsideBoundary {
 		return false
@@ -32,13 +32,13 @@ func (d Dielectric) Scatter(rIn, scattered *utils.Ray, attenuation *utils.Vec3,
 	cannotRefract := ri*sinTheta > 1.0
 	var direction utils.Vec3
 
-	if cannotRefract || reflectance(cosTheta, ri) > utils.RandomFloat() {
+	if cannotRefract || reflectance(cosTheta, ri) > rIn.Rng.Float64() {
 		direction = utils.Reflect(unitDirection, rec.Normal)
 	} else {
 		direction = utils.Refract(unitDirection, rec.Normal, ri)
 	}
 
-	*scattered = utils.Ray{Origin: rec.P, Direction: direction, Tm: rIn.Tm}
+	*scattered = utils.Ray{Origin: rec.P, Direction: direction, Tm: rIn.Tm, Rng: rIn.Rng}
 	return true
 }
 
@@ -47,3 +47,19 @@ func reflectance(cosine, refractionIndex float64) float64 {
 	r0 = r0 * r0
 	return r0 + (1-r0)*math.Pow(1-cosine, 5)
 }
+
+// ScatterPDF reports the specular bounce from Scatter without a density
+func (d Dielectric) ScatterPDF(rIn *utils.Ray, rec *utils.HitRecord, srec *utils.ScatterRecord) bool {
+	srec.SkipPDF = true
+	srec.PDF = nil
+	return d.Scatter(rIn, &srec.SkipPDFRay, &srec.Attenuation, rec)
+}
+
+func (d Dielectric) ScatteringPDF(rIn *utils.Ray, rec *utils.HitRecord, scattered *utils.Ray) float64 {
+	return 0
+}
+
+// AlbedoAt is white, glass doesn't absorb anything
+func (d Dielectric) AlbedoAt(rec *utils.HitRecord) utils.Vec3 {
+	return utils.Vec3{X: 1, Y: 1, Z: 1}
+}
@@ -21,3 +21,9 @@ func NewDiffuseLightFromTexture(texture utils.Texture) *DiffuseLight {
 func (d *DiffuseLight) ColorEmitted(u, v float64, p utils.Vec3) utils.Vec3 {
 	return d.texture.Value(u, v, p)
 }
+
+// AlbedoAt is the emitted color clamped to 1, so lights look like bright surfaces to a denoiser
+func (d *DiffuseLight) AlbedoAt(rec *utils.HitRecord) utils.Vec3 {
+	c := d.texture.Value(rec.U, rec.V, rec.P)
+	return utils.Vec3{X: min(c.X, 1), Y: min(c.Y, 1), Z: min(c.Z, 1)}
+}
@@ -1,17 +1,32 @@
 package material
 
-import "github.com/philippkk/coms336/raytracer/internal/utils"
+import (
+	"github.com/philippkk/coms336/raytracer/internal/utils"
+	"math"
+)
 
 type Isotropic struct {
 	texture utils.Texture
 }
 
+// Scatter sends the ray on in a uniformly random direction from the hit point
 func (i Isotropic) Scatter(rIn, scattered *utils.Ray, attenuation *utils.Vec3, rec *utils.HitRecord) bool {
-	scattered = &utils.Ray{Origin: rec.P, Direction: utils.RandomUnitVector(), Tm: rIn.Tm}
+	*scattered = utils.Ray{Origin: rec.P, Direction: rIn.Rng.UnitVector(), Tm: rIn.Tm, Rng: rIn.Rng}
 	*attenuation = i.texture.Value(rec.U, rec.V, rec.P)
 	return true
 }
 
+func (i Isotropic) ScatterPDF(rIn *utils.Ray, rec *utils.HitRecord, srec *utils.ScatterRecord) bool {
+	srec.Attenuation = i.texture.Value(rec.U, rec.V, rec.P)
+	srec.PDF = utils.SpherePDF{}
+	srec.SkipPDF = false
+	return true
+}
+
+func (i Isotropic) ScatteringPDF(rIn *utils.Ray, rec *utils.HitRecord, scattered *utils.Ray) float64 {
+	return 1 / (4 * math.Pi)
+}
+
 func (i Isotropic) ColorEmitted(u, v float64, p utils.Vec3) utils.Vec3 {
 	return utils.Vec3{}
 }
@@ -23,3 +38,7 @@ func NewIsotropicFromColor(color utils.Vec3) *Isotropic {
 func NewIsotropicFromTexture(texture utils.Texture) *Isotropic {
 	return &Isotropic{texture}
 }
+
+func (i Isotropic) AlbedoAt(rec *utils.HitRecord) utils.Vec3 {
+	return i.texture.Value(rec.U, rec.V, rec.P)
+}
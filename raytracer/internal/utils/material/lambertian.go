@@ -2,6 +2,7 @@ package material
 
 import (
 	"github.com/philippkk/coms336/raytracer/internal/utils"
+	"math"
 )
 
 type Lambertian struct {
@@ -21,14 +22,30 @@ func NewLambertian(tex utils.Texture) *Lambertian {
 }
 
 func (l Lambertian) Scatter(rIn, scattered *utils.Ray, attenuation *utils.Vec3, rec *utils.HitRecord) bool {
-	scatterDirection := rec.Normal.PlusEq(utils.RandomUnitVector())
+	scatterDirection := rec.Normal.PlusEq(rIn.Rng.UnitVector())
 
 	if scatterDirection.NearZero() {
 		scatterDirection = rec.Normal
 	}
 
-	*scattered = utils.Ray{Origin: rec.P, Direction: scatterDirection, Tm: rIn.Tm}
+	*scattered = utils.Ray{Origin: rec.P, Direction: scatterDirection, Tm: rIn.Tm, Rng: rIn.Rng}
 
 	*attenuation = l.Tex.Value(rec.U, rec.V, rec.P)
 	return true
 }
+
+func (l Lambertian) ScatterPDF(rIn *utils.Ray, rec *utils.HitRecord, srec *utils.ScatterRecord) bool {
+	srec.Attenuation = l.Tex.Value(rec.U, rec.V, rec.P)
+	srec.PDF = utils.NewCosinePDF(rec.Normal)
+	srec.SkipPDF = false
+	return true
+}
+
+func (l Lambertian) ScatteringPDF(rIn *utils.Ray, rec *utils.HitRecord, scattered *utils.Ray) float64 {
+	cosTheta := rec.Normal.Dot(scattered.Direction.UnitVector())
+	return math.Max(0, cosTheta/math.Pi)
+}
+
+func (l Lambertian) AlbedoAt(rec *utils.HitRecord) utils.Vec3 {
+	return l.Tex.Value(rec.U, rec.V, rec.P)
+}
@@ -15,8 +15,23 @@ func (m Metal) ColorEmitted(u, v float64, p utils.Vec3) utils.Vec3 {
 
 func (m Metal) Scatter(rIn, scattered *utils.Ray, attenuation *utils.Vec3, rec *utils.HitRecord) bool {
 	reflected := utils.Reflect(rIn.Direction, rec.Normal)
-	reflected = reflected.UnitVector().PlusEq(utils.RandomUnitVector().TimesConst(m.Fuzz))
-	*scattered = utils.Ray{Origin: rec.P, Direction: reflected, Tm: rIn.Tm}
+	reflected = reflected.UnitVector().PlusEq(rIn.Rng.UnitVector().TimesConst(m.Fuzz))
+	*scattered = utils.Ray{Origin: rec.P, Direction: reflected, Tm: rIn.Tm, Rng: rIn.Rng}
 	*attenuation = m.Albedo
 	return scattered.Direction.Dot(rec.Normal) > 0
 }
+
+// ScatterPDF reports the specular bounce from Scatter without a density
+func (m Metal) ScatterPDF(rIn *utils.Ray, rec *utils.HitRecord, srec *utils.ScatterRecord) bool {
+	srec.SkipPDF = true
+	srec.PDF = nil
+	return m.Scatter(rIn, &srec.SkipPDFRay, &srec.Attenuation, rec)
+}
+
+func (m Metal) ScatteringPDF(rIn *utils.Ray, rec *utils.HitRecord, scattered *utils.Ray) float64 {
+	return 0
+}
+
+func (m Metal) AlbedoAt(rec *utils.HitRecord) utils.Vec3 {
+	return m.Albedo
+}
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Keyframe places an object at a point in scene time. The object is scaled
+// first, then rotated around X, Y and Z and then moved. Rotations are in
+// degrees and interpolate as angles, so 0 to 360 is a full turn.
+type Keyframe struct {
+	Time      float64
+	Translate Vec3
+	Rotate    Vec3
+	// Scale of 0 on an axis is taken as 1, so the zero Keyframe changes nothing
+	Scale Vec3
+}
+
+// motionBoundsSteps is how many poses between two keyframes the bounds are
+// taken over
+const motionBoundsSteps = 32
+
+func (k Keyframe) scale() Vec3 {
+	s := k.Scale
+	if s.X == 0 {
+		s.X = 1
+	}
+	if s.Y == 0 {
+		s.Y = 1
+	}
+	if s.Z == 0 {
+		s.Z = 1
+	}
+	return s
+}
+
+func (k Keyframe) objectToWorld() Mat4 {
+	return Translation(k.Translate).
+		Mul(RotationZ(k.Rotate.Z)).
+		Mul(RotationY(k.Rotate.Y)).
+		Mul(RotationX(k.Rotate.X)).
+		Mul(Scaling(k.scale()))
+}
+
+// worldToObject undoes objectToWorld step by step, cheaper than a general inverse
+func (k Keyframe) worldToObject() Mat4 {
+	s := k.scale()
+	return Scaling(Vec3{1 / s.X, 1 / s.Y, 1 / s.Z}).
+		Mul(RotationX(-k.Rotate.X)).
+		Mul(RotationY(-k.Rotate.Y)).
+		Mul(RotationZ(-k.Rotate.Z)).
+		Mul(Translation(k.Translate.Neg()))
+}
+
+func lerpKeyframe(a, b Keyframe, t float64) Keyframe {
+	lerp := func(x, y Vec3) Vec3 {
+		return x.TimesConst(1 - t).PlusEq(y.TimesConst(t))
+	}
+	return Keyframe{
+		Time:      a.Time + (b.Time-a.Time)*t,
+		Translate: lerp(a.Translate, b.Translate),
+		Rotate:    lerp(a.Rotate, b.Rotate),
+		Scale:     lerp(a.scale(), b.scale()),
+	}
+}
+
+// Motion moves Object through its keyframes over time, rays see it where it is
+// at their time. Before the first and after the last keyframe it holds still.
+type Motion struct {
+	Object    Hittable
+	keyframes []Keyframe
+	bbox      AABB
+}
+
+// NewMotion sorts the keyframes by time. It fails without any, or when two
+// neighbouring keyframes flip the sign of a scale, since the object would be
+// squashed flat on its way between them.
+func NewMotion(object Hittable, keyframes ...Keyframe) (*Motion, error) {
+	if len(keyframes) == 0 {
+		return nil, errors.New("motion needs at least one keyframe")
+	}
+	keys := append([]Keyframe(nil), keyframes...)
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].Time < keys[j].Time })
+	for i := 1; i < len(keys); i++ {
+		a, b := keys[i-1].scale(), keys[i].scale()
+		if a.X*b.X < 0 || a.Y*b.Y < 0 || a.Z*b.Z < 0 {
+			return nil, fmt.Errorf("motion keyframes at times %g and %g scale through zero", keys[i-1].Time, keys[i].Time)
+		}
+	}
+	m := &Motion{Object: object, keyframes: keys}
+	m.bbox = m.sweptBounds()
+	return m, nil
+}
+
+// NewLinearMotion moves object from one pose at time 0 to another at time 1
+func NewLinearMotion(object Hittable, from, to Keyframe) (*Motion, error) {
+	from.Time, to.Time = 0, 1
+	return NewMotion(object, from, to)
+}
+
+// at is the pose at time t
+func (m *Motion) at(t float64) Keyframe {
+	keys := m.keyframes
+	if t <= keys[0].Time {
+		return keys[0]
+	}
+	if t >= keys[len(keys)-1].Time {
+		return keys[len(keys)-1]
+	}
+	i := sort.Search(len(keys), func(i int) bool { return keys[i].Time > t }) - 1
+	a, b := keys[i], keys[i+1]
+	return lerpKeyframe(a, b, (t-a.Time)/(b.Time-a.Time))
+}
+
+// sweptBounds is the box around every pose between the keyframes. Poses are
+// taken in steps. Without rotation points move in straight lines and can't
+// leave the boxes of two neighbouring poses, with it they can bulge out by at
+// most half the distance they travel in one step, so the bounds are padded by
+// that.
+func (m *Motion) sweptBounds() AABB {
+	box := m.Object.BoundingBox()
+	radius := 0.0
+	for _, x := range []float64{box.X.Min, box.X.Max} {
+		for _, y := range []float64{box.Y.Min, box.Y.Max} {
+			for _, z := range []float64{box.Z.Min, box.Z.Max} {
+				radius = math.Max(radius, Vec3{x, y, z}.Length())
+			}
+		}
+	}
+
+	bounds := m.keyframes[0].objectToWorld().TransformBox(box)
+	pad := 0.0
+	for i := 1; i < len(m.keyframes); i++ {
+		a, b := m.keyframes[i-1], m.keyframes[i]
+		for step := 1; step <= motionBoundsSteps; step++ {
+			pose := lerpKeyframe(a, b, float64(step)/motionBoundsSteps)
+			bounds = SurroundingBox(bounds, pose.objectToWorld().TransformBox(box))
+		}
+
+		turn := b.Rotate.MinusEq(a.Rotate)
+		if turn == (Vec3{}) {
+			continue
+		}
+		// Angles add up to more than the real turn, which keeps the bound safe
+		stepAngle := DegreesToRadians(math.Abs(turn.X)+math.Abs(turn.Y)+math.Abs(turn.Z)) / motionBoundsSteps
+		sa, sb := a.scale(), b.scale()
+		maxScale := math.Max(maxAbs(sa), maxAbs(sb))
+		stepScale := maxAbs(sb.MinusEq(sa)) / motionBoundsSteps
+		pad = math.Max(pad, radius*(maxScale*stepAngle+stepScale)/2)
+	}
+	return NewAABBFromIntervals(
+		Interval{bounds.X.Min - pad, bounds.X.Max + pad},
+		Interval{bounds.Y.Min - pad, bounds.Y.Max + pad},
+		Interval{bounds.Z.Min - pad, bounds.Z.Max + pad},
+	)
+}
+
+func maxAbs(v Vec3) float64 {
+	return math.Max(math.Abs(v.X), math.Max(math.Abs(v.Y), math.Abs(v.Z)))
+}
+
+func (m *Motion) BoundingBox() AABB {
+	return m.bbox
+}
+
+func (m *Motion) Hit(r *Ray, rayT Interval, rec *HitRecord) bool {
+	pose := m.at(r.Tm)
+	worldToObject := pose.worldToObject()
+	objectRay := Ray{
+		worldToObject.TransformPoint(r.Origin),
+		worldToObject.TransformVector(r.Direction),
+		r.Tm,
+		r.Rng,
+	}
+	if !m.Object.Hit(&objectRay, rayT, rec) {
+		return false
+	}
+	rec.P = pose.objectToWorld().TransformPoint(rec.P)
+	rec.Normal = worldToObject.Transpose().TransformVector(rec.Normal).UnitVector()
+	return true
+}
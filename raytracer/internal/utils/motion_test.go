@@ -0,0 +1,102 @@
+package utils
+
+import "testing"
+
+func TestMotionAt(t *testing.T) {
+	m, err := NewMotion(testSphere{radius: 1},
+		Keyframe{Time: 2, Translate: Vec3{10, 0, 0}, Rotate: Vec3{0, 90, 0}, Scale: Vec3{2, 2, 2}},
+		Keyframe{Time: 0},
+		Keyframe{Time: 1, Translate: Vec3{0, 4, 0}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		t         float64
+		translate Vec3
+		rotate    Vec3
+		scale     Vec3
+	}{
+		{"before the first", -1, Vec3{}, Vec3{}, Vec3{1, 1, 1}},
+		{"on the first", 0, Vec3{}, Vec3{}, Vec3{1, 1, 1}},
+		{"between the first two", 0.25, Vec3{0, 1, 0}, Vec3{}, Vec3{1, 1, 1}},
+		{"on the middle", 1, Vec3{0, 4, 0}, Vec3{}, Vec3{1, 1, 1}},
+		{"between the last two", 1.5, Vec3{5, 2, 0}, Vec3{0, 45, 0}, Vec3{1.5, 1.5, 1.5}},
+		{"on the last", 2, Vec3{10, 0, 0}, Vec3{0, 90, 0}, Vec3{2, 2, 2}},
+		{"after the last", 5, Vec3{10, 0, 0}, Vec3{0, 90, 0}, Vec3{2, 2, 2}},
+	}
+	for _, tt := range tests {
+		pose := m.at(tt.t)
+		if !vecNearlyEqual(pose.Translate, tt.translate, 1e-12) ||
+			!vecNearlyEqual(pose.Rotate, tt.rotate, 1e-12) ||
+			!vecNearlyEqual(pose.scale(), tt.scale, 1e-12) {
+			t.Errorf("%s: at(%v) = %+v, want translate %v, rotate %v, scale %v",
+				tt.name, tt.t, pose, tt.translate, tt.rotate, tt.scale)
+		}
+	}
+}
+
+func TestMotionSweptBounds(t *testing.T) {
+	sphere := testSphere{center: Vec3{1, 0.5, -2}, radius: 0.75}
+	tests := []struct {
+		name      string
+		keyframes []Keyframe
+	}{
+		{"still", []Keyframe{{}}},
+		{"moving", []Keyframe{{Time: 0}, {Time: 1, Translate: Vec3{3, -2, 1}}}},
+		{"spinning", []Keyframe{{Time: 0}, {Time: 1, Rotate: Vec3{0, 360, 0}}}},
+		{"tumbling", []Keyframe{{Time: 0}, {Time: 1, Rotate: Vec3{170, -250, 400}, Translate: Vec3{1, 1, 1}}}},
+		{"growing while turning", []Keyframe{{Time: 0, Scale: Vec3{0.5, 1, 1}}, {Time: 1, Rotate: Vec3{0, 0, 180}, Scale: Vec3{3, 1, 2}}}},
+		{"mirrored", []Keyframe{{Time: 0, Scale: Vec3{-1, 1, 1}}, {Time: 1, Rotate: Vec3{90, 0, 0}, Scale: Vec3{-2, 1, 1}}}},
+		{"several keyframes", []Keyframe{
+			{Time: 0},
+			{Time: 0.3, Translate: Vec3{0, 5, 0}, Rotate: Vec3{45, 0, 0}},
+			{Time: 0.6, Translate: Vec3{-4, 5, 0}, Rotate: Vec3{45, 180, 0}, Scale: Vec3{2, 2, 2}},
+			{Time: 1, Rotate: Vec3{0, 0, 720}},
+		}},
+	}
+	rng := NewRNG(11)
+	for _, tt := range tests {
+		m, err := NewMotion(sphere, tt.keyframes...)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		bounds := m.BoundingBox()
+		box := sphere.BoundingBox()
+		for i := 0; i < 2000; i++ {
+			tm := rng.FloatInRange(-0.1, 1.1)
+			// Every corner of the object's box, wherever the pose puts it
+			toWorld := m.at(tm).objectToWorld()
+			for _, x := range []float64{box.X.Min, box.X.Max} {
+				for _, y := range []float64{box.Y.Min, box.Y.Max} {
+					for _, z := range []float64{box.Z.Min, box.Z.Max} {
+						p := toWorld.TransformPoint(Vec3{x, y, z})
+						if !bounds.X.contains(p.X) || !bounds.Y.contains(p.Y) || !bounds.Z.contains(p.Z) {
+							t.Fatalf("%s: at time %v the point %v lies outside the bounds %v", tt.name, tm, p, bounds)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestNewMotionErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		keyframes []Keyframe
+	}{
+		{"no keyframes", nil},
+		{"scale flips", []Keyframe{{Time: 0, Scale: Vec3{1, 1, 1}}, {Time: 1, Scale: Vec3{1, -1, 1}}}},
+		{"scale flips out of order", []Keyframe{{Time: 1, Scale: Vec3{0, 0, -2}}, {Time: 0}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewMotion(testSphere{radius: 1}, tt.keyframes...); err == nil {
+			t.Errorf("%s: NewMotion returned no error", tt.name)
+		}
+	}
+	if _, err := NewLinearMotion(testSphere{radius: 1}, Keyframe{Scale: Vec3{-1, 0, 0}}, Keyframe{Scale: Vec3{-3, 2, 0}}); err != nil {
+		t.Errorf("a mirrored object that stays mirrored: %v", err)
+	}
+}
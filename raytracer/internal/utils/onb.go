@@ -0,0 +1,24 @@
+package utils
+
+import "math"
+
+// ONB is an orthonormal basis whose W axis points along a given normal
+type ONB struct {
+	U, V, W Vec3
+}
+
+func NewONB(n Vec3) ONB {
+	w := n.UnitVector()
+	a := Vec3{X: 1}
+	if math.Abs(w.X) > 0.9 {
+		a = Vec3{Y: 1}
+	}
+	v := w.Cross(a).UnitVector()
+	u := w.Cross(v)
+	return ONB{U: u, V: v, W: w}
+}
+
+// Transform converts a vector expressed in the basis into world space
+func (o ONB) Transform(v Vec3) Vec3 {
+	return o.U.TimesConst(v.X).PlusEq(o.V.TimesConst(v.Y)).PlusEq(o.W.TimesConst(v.Z))
+}
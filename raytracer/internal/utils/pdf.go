@@ -0,0 +1,110 @@
+package utils
+
+import "math"
+
+// PDF is a direction sampling strategy together with its solid angle density
+type PDF interface {
+	Value(direction Vec3) float64
+	Generate(u PDFSample) Vec3
+}
+
+// PDFSample is the random input of PDF.Generate. Pick chooses a mixture
+// component and UV is warped into the direction.
+type PDFSample struct {
+	Pick float64
+	UV   Vec2
+}
+
+// NextPDFSample takes the dimensions of one PDFSample from s
+func NextPDFSample(s Sampler) PDFSample {
+	return PDFSample{Pick: s.Get1D(), UV: s.Get2D()}
+}
+
+// ScatterRecord is filled in by PDFMaterial.ScatterPDF. Specular materials set
+// SkipPDF and give the exact outgoing ray instead of a density.
+type ScatterRecord struct {
+	Attenuation Vec3
+	PDF         PDF
+	SkipPDF     bool
+	SkipPDFRay  Ray
+}
+
+// PDFMaterial is implemented by materials that describe their scattering with a PDF.
+// Materials that only implement Material keep working through Scatter.
+type PDFMaterial interface {
+	Material
+	ScatterPDF(rIn *Ray, rec *HitRecord, srec *ScatterRecord) bool
+
+	// ScatteringPDF is the density the material would scatter rIn into scattered,
+	// the BSDF times cosine is Attenuation * ScatteringPDF
+	ScatteringPDF(rIn *Ray, rec *HitRecord, scattered *Ray) float64
+}
+
+// SpherePDF samples directions uniformly over the unit sphere
+type SpherePDF struct{}
+
+func (SpherePDF) Value(direction Vec3) float64 {
+	return 1 / (4 * pi)
+}
+
+func (SpherePDF) Generate(u PDFSample) Vec3 {
+	return SampleUniformSphere(u.UV)
+}
+
+// CosinePDF samples directions around a normal proportional to the cosine
+type CosinePDF struct {
+	uvw ONB
+}
+
+func NewCosinePDF(w Vec3) CosinePDF {
+	return CosinePDF{uvw: NewONB(w)}
+}
+
+func (p CosinePDF) Value(direction Vec3) float64 {
+	cosine := direction.UnitVector().Dot(p.uvw.W)
+	return math.Max(0, cosine/pi)
+}
+
+func (p CosinePDF) Generate(u PDFSample) Vec3 {
+	return p.uvw.Transform(SampleCosineHemisphere(u.UV))
+}
+
+// HittablePDF samples directions from Origin towards a light
+type HittablePDF struct {
+	Object Light
+	Origin Vec3
+	Rng    *RNG
+}
+
+func (p HittablePDF) Value(direction Vec3) float64 {
+	return p.Object.PDFValue(p.Origin, direction, p.Rng)
+}
+
+func (p HittablePDF) Generate(u PDFSample) Vec3 {
+	return p.Object.Random(p.Origin, u.UV)
+}
+
+// MixturePDF picks one of its PDFs uniformly for every sample, Pick is stretched
+// back to [0, 1) so nested mixtures can pick again
+type MixturePDF struct {
+	PDFs []PDF
+}
+
+func NewMixturePDF(pdfs ...PDF) MixturePDF {
+	return MixturePDF{PDFs: pdfs}
+}
+
+func (p MixturePDF) Value(direction Vec3) float64 {
+	sum := 0.0
+	for _, pdf := range p.PDFs {
+		sum += pdf.Value(direction)
+	}
+	return sum / float64(len(p.PDFs))
+}
+
+func (p MixturePDF) Generate(u PDFSample) Vec3 {
+	scaled := u.Pick * float64(len(p.PDFs))
+	i := min(int(scaled), len(p.PDFs)-1)
+	u.Pick = math.Min(scaled-float64(i), oneMinusEpsilon)
+	return p.PDFs[i].Generate(u)
+}
@@ -0,0 +1,66 @@
+package utils
+
+import "math"
+
+// PhysicalCamera describes the camera body and lens. Set on a Camera it takes
+// over from Vfov and DefocusAngle: the focal length and sensor give the field
+// of view, the f-stop the size of the lens opening, and the f-stop, exposure
+// time and ISO how bright the image comes out. Zero fields take the default.
+// The exposure time only sets the brightness, how much motion blur there is
+// comes from the Camera's ShutterOpen and ShutterClose in scene time.
+type PhysicalCamera struct {
+	FStop        float64 // 0 means f/2.8
+	FocalLength  float64 // in mm, 0 means 50
+	SensorWidth  float64 // in mm, 0 means 36 for full frame
+	ExposureTime float64 // in seconds, 0 means 1/60
+	ISO          float64 // 0 means 100
+	// UnitsPerMeter is how many world units make a meter, the lens opening is
+	// converted with it. 0 means 1.
+	UnitsPerMeter float64
+}
+
+// The exposure the image brightness is calibrated to, it looks the same as
+// without a physical camera
+const (
+	referenceFStop        = 2.8
+	referenceExposureTime = 1.0 / 60
+	referenceISO          = 100
+)
+
+func (p PhysicalCamera) fStop() float64 {
+	return orDefault(p.FStop, referenceFStop)
+}
+
+func (p PhysicalCamera) focalLength() float64 {
+	return orDefault(p.FocalLength, 50)
+}
+
+// VerticalFOV is the vertical field of view in degrees for an image with the
+// given width to height ratio, with the lens focused at infinity
+func (p PhysicalCamera) VerticalFOV(aspectRatio float64) float64 {
+	sensorHeight := orDefault(p.SensorWidth, 36) / aspectRatio
+	return 2 * math.Atan(sensorHeight/(2*p.focalLength())) * 180 / pi
+}
+
+// ApertureRadius is the radius of the lens opening in world units
+func (p PhysicalCamera) ApertureRadius() float64 {
+	diameter := p.focalLength() / p.fStop() / 1000
+	return diameter / 2 * orDefault(p.UnitsPerMeter, 1)
+}
+
+// ExposureScale is what the radiance is multiplied by, relative to f/2.8 at
+// 1/60 s and ISO 100. Every stop the f-stop closes halves it, every doubling
+// of exposure time or ISO doubles it.
+func (p PhysicalCamera) ExposureScale() float64 {
+	n := p.fStop()
+	t := orDefault(p.ExposureTime, referenceExposureTime)
+	iso := orDefault(p.ISO, referenceISO)
+	return (t * iso / (n * n)) / (referenceExposureTime * referenceISO / (referenceFStop * referenceFStop))
+}
+
+func orDefault(v, fallback float64) float64 {
+	if v > 0 {
+		return v
+	}
+	return fallback
+}
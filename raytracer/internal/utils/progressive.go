@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+)
+
+// Accumulator is the float buffer progressive rendering adds its passes to
+type Accumulator struct {
+	Width, Height int
+	Passes        int
+	sum           []Vec3
+	weight        []float64 // the filter weights in sum, the number of passes for a box filter
+	pass          []Vec3    // the pass being rendered, only added to sum once it is complete
+	passWeight    []float64
+
+	// This pass's samples and where in their pixels they were taken, so pixels
+	// can gather the ones their filter reaches
+	samples, offsets []Vec3
+	// The sum of each pixel's own samples, shown where the filter weights
+	// cancel out
+	own, ownPass []Vec3
+
+	// First hits for the camera's AOVs, kept the same way as the colors
+	aovSum, aovPass []aovPixel
+	aovs            []AOV
+
+	stereo StereoMode
+}
+
+func NewAccumulator(width, height int) *Accumulator {
+	return &Accumulator{
+		Width:      width,
+		Height:     height,
+		sum:        make([]Vec3, width*height),
+		weight:     make([]float64, width*height),
+		pass:       make([]Vec3, width*height),
+		passWeight: make([]float64, width*height),
+	}
+}
+
+// Reset throws away everything accumulated, call it when the camera moves
+func (a *Accumulator) Reset() {
+	clear(a.sum)
+	clear(a.weight)
+	clear(a.aovSum)
+	clear(a.own)
+	a.Passes = 0
+}
+
+// Average is the pixel's filtered color over all passes so far
+func (a *Accumulator) Average(x, y int) Vec3 {
+	i := y*a.Width + x
+	return a.filtered(a.sum[i], a.weight[i], a.own, i, a.Passes)
+}
+
+// filtered is a pixel's filtered color, or the plain average of its own
+// samples over passes passes where the filter weights cancel out like
+// resolveFilm does
+func (a *Accumulator) filtered(sum Vec3, weight float64, own []Vec3, i, passes int) Vec3 {
+	if weight > minFilterWeight {
+		return sum.TimesConst(1 / weight)
+	}
+	if own == nil || passes == 0 {
+		return Vec3{}
+	}
+	return own[i].TimesConst(1 / float64(passes))
+}
+
+// Image is the average so far as an HDR framebuffer, every pixel counting
+// one sample per pass. Before the first pass every pixel is left unrendered.
+func (a *Accumulator) Image() *Framebuffer {
+	image := NewFramebuffer(a.Width, a.Height)
+	image.Stereo = a.stereo
+	if a.Passes == 0 {
+		return image
+	}
+	for y := 0; y < a.Height; y++ {
+		for x := 0; x < a.Width; x++ {
+			image.Set(x, y, a.Average(x, y), a.Passes)
+		}
+	}
+	fillAOVs(image, a.aovs, a.aovSum)
+	return image
+}
+
+// RenderPass adds one sample per pixel to acc and shows the running average on
+// sink. Pass n takes sample index n, so SamplesPerPixel passes add up to the
+// image Render gives without adaptive sampling. A pass cancelled through ctx is
+// thrown away, acc keeps the passes before it and ctx.Err() is returned.
+func (c *Camera) RenderPass(ctx context.Context, world HittableList, acc *Accumulator, sink RenderSink) error {
+	c.initialize()
+	sample := acc.Passes
+	acc.stereo = c.Stereo
+	if aovs := c.renderAOVs(); len(aovs) > 0 && acc.aovSum == nil {
+		acc.aovSum = make([]aovPixel, acc.Width*acc.Height)
+		acc.aovPass = make([]aovPixel, acc.Width*acc.Height)
+		acc.aovs = aovs
+	}
+
+	splats := c.Filter.splats()
+	if splats && acc.samples == nil {
+		acc.samples = make([]Vec3, acc.Width*acc.Height)
+		acc.offsets = make([]Vec3, acc.Width*acc.Height)
+		acc.own = make([]Vec3, acc.Width*acc.Height)
+		acc.ownPass = make([]Vec3, acc.Width*acc.Height)
+	}
+
+	var nextRow atomic.Int32
+	worker := func() {
+		rng := NewRNG(0)
+		sampler := NewSampler(c.Sampler, c.SamplesPerPixel, c.Seed)
+		for {
+			y := int(nextRow.Add(1)) - 1
+			if y >= c.imageHeight || ctx.Err() != nil {
+				return
+			}
+			for x := 0; x < c.ImageWidth; x++ {
+				rng.Seed(SampleSeed(c.Seed, x, y, sample))
+				sampler.StartPixelSample(x, y, sample)
+				ray, offset := c.getRay(x, y, sampler, rng)
+				i := y*acc.Width + x
+				sampleColor := c.rayColor(&ray, c.MaxDepth, &world, 1, sampler).TimesConst(c.sensorScale)
+				if acc.aovSum != nil {
+					acc.aovPass[i] = acc.aovSum[i]
+					acc.aovPass[i].addAOVSample(ray, &world)
+				}
+				if splats {
+					acc.samples[i], acc.offsets[i] = sampleColor, offset
+					acc.ownPass[i] = acc.own[i].PlusEq(sampleColor)
+					continue
+				}
+				acc.pass[i] = acc.sum[i].PlusEq(sampleColor)
+				acc.passWeight[i] = acc.weight[i] + 1
+				sink.UpdatePixel(x, y, c.ToneMap.Color(acc.pass[i].TimesConst(1/acc.passWeight[i])))
+			}
+		}
+	}
+
+	// Every pixel gathers the samples its filter reaches once they are all
+	// taken, rows never write to each other so no locking is needed
+	margin := c.Filter.margin()
+	gather := func() {
+		for {
+			y := int(nextRow.Add(1)) - 1
+			if y >= c.imageHeight || ctx.Err() != nil {
+				return
+			}
+			for x := 0; x < c.ImageWidth; x++ {
+				i := y*acc.Width + x
+				sum, weight := acc.sum[i], acc.weight[i]
+				eye := eyeBounds(c.Stereo, c.ImageWidth, c.imageHeight, x, y)
+				for qy := max(eye.Min.Y, y-margin); qy < min(eye.Max.Y, y+margin+1); qy++ {
+					for qx := max(eye.Min.X, x-margin); qx < min(eye.Max.X, x+margin+1); qx++ {
+						j := qy*acc.Width + qx
+						offset := acc.offsets[j]
+						w := c.Filter.Evaluate(float64(x-qx)-offset.X, float64(y-qy)-offset.Y)
+						if w != 0 {
+							sum = sum.PlusEq(acc.samples[j].TimesConst(w))
+							weight += w
+						}
+					}
+				}
+				acc.pass[i], acc.passWeight[i] = sum, weight
+				sink.UpdatePixel(x, y, c.ToneMap.Color(acc.filtered(sum, weight, acc.ownPass, i, acc.Passes+1)))
+			}
+		}
+	}
+
+	workers := make([]func(), runtime.NumCPU())
+	for i := range workers {
+		workers[i] = worker
+	}
+	Parallelize(workers...)
+	if splats && ctx.Err() == nil {
+		nextRow.Store(0)
+		for i := range workers {
+			workers[i] = gather
+		}
+		Parallelize(workers...)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	acc.sum, acc.pass = acc.pass, acc.sum
+	acc.weight, acc.passWeight = acc.passWeight, acc.weight
+	acc.aovSum, acc.aovPass = acc.aovPass, acc.aovSum
+	acc.own, acc.ownPass = acc.ownPass, acc.own
+	acc.Passes++
+	return nil
+}
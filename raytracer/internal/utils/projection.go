@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+)
+
+// Projection is how the camera maps pixels to rays
+type Projection int
+
+const (
+	PerspectiveProjection     Projection = iota // pinhole or thin lens frustum from Vfov
+	OrthographicProjection                      // parallel rays over a view OrthoHeight tall
+	EquirectangularProjection                   // full 360 by 180 degree lat-long panorama
+	FisheyeProjection                           // equal-angle fisheye over FisheyeFOV degrees
+	CubeFaceProjection                          // one world aligned 90 degree face of a cube map
+)
+
+var projectionNames = map[Projection]string{
+	PerspectiveProjection:     "perspective",
+	OrthographicProjection:    "orthographic",
+	EquirectangularProjection: "equirectangular",
+	FisheyeProjection:         "fisheye",
+	CubeFaceProjection:        "cube",
+}
+
+func (p Projection) String() string {
+	if name, ok := projectionNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Projection(%d)", int(p))
+}
+
+func ParseProjection(name string) (Projection, error) {
+	for p, n := range projectionNames {
+		if n == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown projection %q, expected perspective, orthographic, equirectangular, fisheye or cube", name)
+}
+
+// panoramic projections aim every ray from LookFrom by its place on the
+// image instead of through a viewport, they ignore Vfov and the lens
+func (p Projection) panoramic() bool {
+	return p == EquirectangularProjection || p == FisheyeProjection || p == CubeFaceProjection
+}
+
+// CubeFaceNames are the file names NewCubeMap's faces are usually stored
+// under, in the order of the RIGHT to BACK face identifiers
+var CubeFaceNames = [6]string{"posx", "negx", "posy", "negy", "posz", "negz"}
+
+func ParseCubeFace(name string) (int, error) {
+	for face, n := range CubeFaceNames {
+		if n == name {
+			return face, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown cube face %q, expected posx, negx, posy, negy, posz or negz", name)
+}
+
+// panoramaDirection is the direction a panoramic camera looks at image
+// position x, y, both from 0 to 1 with y going down. ok is false outside the
+// fisheye's image circle.
+func (c *Camera) panoramaDirection(x, y float64) (dir Vec3, ok bool) {
+	forward := c.w.Neg()
+	switch c.Projection {
+	case EquirectangularProjection:
+		// The center of the image looks at LookAt, longitude grows to the right
+		lon := (x - 0.5) * 2 * math.Pi
+		lat := (0.5 - y) * math.Pi
+		return c.u.TimesConst(math.Cos(lat) * math.Sin(lon)).
+			PlusEq(c.v.TimesConst(math.Sin(lat))).
+			PlusEq(forward.TimesConst(math.Cos(lat) * math.Cos(lon))), true
+	case FisheyeProjection:
+		// The image circle fits the shorter side, the angle from the view
+		// direction grows linearly with the distance from the center
+		fov := c.FisheyeFOV
+		if fov <= 0 {
+			fov = 180
+		}
+		scale := float64(min(c.eyeWidth, c.eyeHeight)) / 2
+		dx := (x - 0.5) * float64(c.eyeWidth) / scale
+		dy := (0.5 - y) * float64(c.eyeHeight) / scale
+		r := math.Sqrt(dx*dx + dy*dy)
+		if r > 1 {
+			return Vec3{}, false
+		}
+		theta := r * DegreesToRadians(fov) / 2
+		phi := math.Atan2(dy, dx)
+		return c.u.TimesConst(math.Sin(theta) * math.Cos(phi)).
+			PlusEq(c.v.TimesConst(math.Sin(theta) * math.Sin(phi))).
+			PlusEq(forward.TimesConst(math.Cos(theta))), true
+	}
+
+	// The inverse of CubeMap.directionToUV, so rendered faces load back as
+	// they were seen. Texture v grows upwards.
+	a := 2*x - 1
+	b := 1 - 2*y
+	switch c.CubeFace {
+	case RIGHT:
+		return Vec3{1, b, -a}, true
+	case LEFT:
+		return Vec3{-1, b, a}, true
+	case TOP:
+		return Vec3{a, 1, b}, true
+	case BOTTOM:
+		return Vec3{a, -1, -b}, true
+	case FRONT:
+		return Vec3{a, b, 1}, true
+	}
+	return Vec3{-a, b, -1}, true
+}
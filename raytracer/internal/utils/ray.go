@@ -4,6 +4,10 @@ type Ray struct {
 	Origin    Vec3
 	Direction Vec3
 	Tm        float64
+
+	// Rng supplies the random numbers for everything sampled along this path,
+	// rays spawned from a hit should pass it on
+	Rng *RNG
 }
 
 func (r *Ray) At(t float64) Vec3 {
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+)
+
+// RenderSink receives pixels from Camera.Render as they are finished.
+// DisplayBuffer is the windowed implementation. Renders are stopped through
+// their context, not the sink.
+type RenderSink interface {
+	UpdatePixel(x, y int, col color.Color)
+	Refresh()
+}
+
+// ShowFramebuffer sends a whole finished image to sink, e.g. after denoising it
+func ShowFramebuffer(sink RenderSink, f *Framebuffer, toneMap ToneMapper) {
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			sink.UpdatePixel(x, y, toneMap.Color(f.At(x, y)))
+		}
+	}
+	sink.Refresh()
+}
+
+// ImageSink writes pixels into an in-memory image, no window needed
+type ImageSink struct {
+	Image *image.RGBA
+}
+
+func NewImageSink(width, height int) *ImageSink {
+	return &ImageSink{Image: image.NewRGBA(image.Rect(0, 0, width, height))}
+}
+
+func (s *ImageSink) UpdatePixel(x, y int, col color.Color) {
+	s.Image.Set(x, y, col)
+}
+
+func (s *ImageSink) Refresh() {}
+
+// NullSink discards every pixel, used for headless renders
+type NullSink struct{}
+
+func (NullSink) UpdatePixel(x, y int, col color.Color) {}
+
+func (NullSink) Refresh() {}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+)
+
+// WriteRGBE writes the framebuffer as a Radiance .hdr file, a shared exponent
+// per pixel with run length encoded scanlines
+func WriteRGBE(w io.Writer, f *Framebuffer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", f.Height, f.Width)
+
+	line := make([]byte, f.Width*4)
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			c := f.At(x, y)
+			copy(line[x*4:], toRGBE(c))
+		}
+		// Readers only understand run length encoding for these widths
+		if f.Width < 8 || f.Width > 0x7fff {
+			bw.Write(line)
+			continue
+		}
+		bw.Write([]byte{2, 2, byte(f.Width >> 8), byte(f.Width)})
+		for channel := 0; channel < 4; channel++ {
+			writeRLEChannel(bw, line, channel, f.Width)
+		}
+	}
+	return bw.Flush()
+}
+
+func toRGBE(c Vec3) []byte {
+	v := math.Max(c.X, math.Max(c.Y, c.Z))
+	if v < 1e-32 {
+		return []byte{0, 0, 0, 0}
+	}
+	m, e := math.Frexp(v)
+	scale := m * 256 / v
+	return []byte{
+		byte(math.Max(0, c.X) * scale),
+		byte(math.Max(0, c.Y) * scale),
+		byte(math.Max(0, c.Z) * scale),
+		byte(e + 128),
+	}
+}
+
+// writeRLEChannel encodes one channel of an RGBE scanline: a count above 128
+// repeats the next byte count-128 times, otherwise count literal bytes follow
+func writeRLEChannel(w *bufio.Writer, line []byte, channel, width int) {
+	at := func(i int) byte { return line[i*4+channel] }
+	const minRun = 4
+
+	for i := 0; i < width; {
+		// Find the next run long enough to be worth encoding
+		runStart := i
+		runLength := 0
+		for runStart < width {
+			runLength = 1
+			for runStart+runLength < width && runLength < 127 && at(runStart+runLength) == at(runStart) {
+				runLength++
+			}
+			if runLength >= minRun {
+				break
+			}
+			runStart += runLength
+		}
+		if runStart >= width {
+			runStart, runLength = width, 0
+		}
+
+		// Bytes before the run go out as literals
+		for i < runStart {
+			n := min(runStart-i, 128)
+			w.WriteByte(byte(n))
+			for k := 0; k < n; k++ {
+				w.WriteByte(at(i + k))
+			}
+			i += n
+		}
+
+		if runLength > 0 {
+			w.WriteByte(byte(128 + runLength))
+			w.WriteByte(at(runStart))
+			i += runLength
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package utils
+
+import "math/bits"
+
+// RNG is a xoshiro256** generator. Every render goroutine owns one and reseeds it
+// for each pixel sample, so an image only depends on the seed and not on how the
+// tiles were scheduled. It rides along on Ray.Rng to reach materials and media.
+type RNG struct {
+	s [4]uint64
+}
+
+func NewRNG(seed uint64) *RNG {
+	r := &RNG{}
+	r.Seed(seed)
+	return r
+}
+
+// Seed resets the state, expanding seed with splitmix64 as xoshiro recommends
+func (r *RNG) Seed(seed uint64) {
+	for i := range r.s {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		r.s[i] = z ^ (z >> 31)
+	}
+}
+
+// SampleSeed mixes the user seed with a pixel and sample index
+func SampleSeed(seed uint64, x, y, sample int) uint64 {
+	h := seed
+	for _, v := range [3]uint64{uint64(x), uint64(y), uint64(sample)} {
+		h ^= v + 0x9e3779b97f4a7c15 + (h << 6) + (h >> 2)
+		h *= 0xff51afd7ed558ccd
+		h ^= h >> 33
+	}
+	return h
+}
+
+func (r *RNG) Uint64() uint64 {
+	result := bits.RotateLeft64(r.s[1]*5, 7) * 9
+	t := r.s[1] << 17
+
+	r.s[2] ^= r.s[0]
+	r.s[3] ^= r.s[1]
+	r.s[1] ^= r.s[2]
+	r.s[0] ^= r.s[3]
+	r.s[2] ^= t
+	r.s[3] = bits.RotateLeft64(r.s[3], 45)
+	return result
+}
+
+// Float64 returns a number in [0, 1)
+func (r *RNG) Float64() float64 {
+	return float64(r.Uint64()>>11) / (1 << 53)
+}
+
+func (r *RNG) FloatInRange(min, max float64) float64 {
+	return min + (max-min)*r.Float64()
+}
+
+func (r *RNG) UnitVector() Vec3 {
+	return SampleUniformSphere(Vec2{r.Float64(), r.Float64()})
+}
@@ -0,0 +1,323 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// Sampler hands out the sample dimensions of one pixel sample in a fixed order:
+// the position in the pixel, the lens, the time and then a few for every bounce.
+// Each render goroutine owns its own sampler.
+type Sampler interface {
+	// StartPixelSample restarts the dimensions for sample index of pixel x, y
+	StartPixelSample(x, y, index int)
+	Get1D() float64
+	Get2D() Vec2
+}
+
+type SamplerType int
+
+const (
+	RandomSampler     SamplerType = iota // independent uniform samples, the default
+	SobolSampler                         // Owen scrambled Sobol, padded per dimension
+	HaltonSampler                        // Halton with Owen scrambled digits per pixel
+	StratifiedSampler                    // jittered strata shuffled per pixel
+)
+
+var samplerNames = map[SamplerType]string{
+	SobolSampler:      "sobol",
+	HaltonSampler:     "halton",
+	StratifiedSampler: "stratified",
+	RandomSampler:     "random",
+}
+
+func (t SamplerType) String() string {
+	if name, ok := samplerNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("SamplerType(%d)", int(t))
+}
+
+func ParseSamplerType(name string) (SamplerType, error) {
+	for t, n := range samplerNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown sampler %q, expected sobol, halton, stratified or random", name)
+}
+
+// NewSampler creates a sampler for renders of samplesPerPixel samples, seed
+// decorrelates whole images the same way Camera.Seed does
+func NewSampler(t SamplerType, samplesPerPixel int, seed uint64) Sampler {
+	switch t {
+	case HaltonSampler:
+		return &haltonSampler{seed: seed, rng: NewRNG(0)}
+	case StratifiedSampler:
+		return &stratifiedSampler{samplesPerPixel: samplesPerPixel, seed: seed, rng: NewRNG(0)}
+	case RandomSampler:
+		return &randomSampler{seed: seed, rng: NewRNG(0)}
+	}
+	return &sobolSampler{seed: seed}
+}
+
+// dimensionHash gives every pixel and dimension its own scramble
+func dimensionHash(seed uint64, x, y, dimension int) uint32 {
+	h := SampleSeed(seed, x, y, dimension)
+	return uint32(h ^ h>>32)
+}
+
+type randomSampler struct {
+	seed uint64
+	rng  *RNG
+}
+
+func (s *randomSampler) StartPixelSample(x, y, index int) {
+	s.rng.Seed(SampleSeed(s.seed^0x5851f42d4c957f2d, x, y, index))
+}
+
+func (s *randomSampler) Get1D() float64 {
+	return s.rng.Float64()
+}
+
+func (s *randomSampler) Get2D() Vec2 {
+	return Vec2{s.rng.Float64(), s.rng.Float64()}
+}
+
+// stratifiedSampler splits every dimension into samplesPerPixel strata (a grid
+// for 2D ones) and visits them in a per pixel random order. Samples past
+// samplesPerPixel fall back to uniform ones.
+type stratifiedSampler struct {
+	samplesPerPixel int
+	seed            uint64
+	x, y, index     int
+	dimension       int
+	rng             *RNG
+}
+
+func (s *stratifiedSampler) StartPixelSample(x, y, index int) {
+	s.x, s.y, s.index, s.dimension = x, y, index, 0
+	s.rng.Seed(SampleSeed(s.seed^0x2545f4914f6cdd1d, x, y, index))
+}
+
+func (s *stratifiedSampler) Get1D() float64 {
+	hash := dimensionHash(s.seed, s.x, s.y, s.dimension)
+	s.dimension++
+	if s.index >= s.samplesPerPixel {
+		return s.rng.Float64()
+	}
+	stratum := permutationElement(uint32(s.index), uint32(s.samplesPerPixel), hash)
+	return (float64(stratum) + s.rng.Float64()) / float64(s.samplesPerPixel)
+}
+
+func (s *stratifiedSampler) Get2D() Vec2 {
+	hash := dimensionHash(s.seed, s.x, s.y, s.dimension)
+	s.dimension += 2
+	if s.index >= s.samplesPerPixel {
+		return Vec2{s.rng.Float64(), s.rng.Float64()}
+	}
+	// Use the squarest grid with at least samplesPerPixel cells
+	nx := max(1, int(math.Sqrt(float64(s.samplesPerPixel))))
+	ny := (s.samplesPerPixel + nx - 1) / nx
+	stratum := int(permutationElement(uint32(s.index), uint32(nx*ny), hash))
+	return Vec2{
+		(float64(stratum%nx) + s.rng.Float64()) / float64(nx),
+		(float64(stratum/nx) + s.rng.Float64()) / float64(ny),
+	}
+}
+
+// haltonPrimes are the bases of the Halton dimensions, later ones are uniform
+var haltonPrimes = [...]uint64{
+	2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53,
+	59, 61, 67, 71, 73, 79, 83, 89, 97, 101, 103, 107, 109, 113, 127, 131,
+}
+
+// haltonSampler uses the same Halton points in every pixel, with the digits of
+// each pixel and dimension randomly permuted (Owen scrambling). A plain random
+// shift leaves the large bases clumped together at low sample counts.
+type haltonSampler struct {
+	seed      uint64
+	x, y      int
+	index     uint64
+	dimension int
+	rng       *RNG
+}
+
+func (s *haltonSampler) StartPixelSample(x, y, index int) {
+	s.x, s.y, s.index, s.dimension = x, y, uint64(index), 0
+	s.rng.Seed(SampleSeed(s.seed^0x9e3779b97f4a7c15, x, y, index))
+}
+
+func (s *haltonSampler) Get1D() float64 {
+	dimension := s.dimension
+	s.dimension++
+	if dimension >= len(haltonPrimes) {
+		return s.rng.Float64()
+	}
+	return owenScrambledRadicalInverse(haltonPrimes[dimension], s.index, dimensionHash(s.seed, s.x, s.y, dimension))
+}
+
+func (s *haltonSampler) Get2D() Vec2 {
+	return Vec2{s.Get1D(), s.Get1D()}
+}
+
+// owenScrambledRadicalInverse mirrors the base digits of index around the
+// decimal point, permuting each digit depending on the ones before it. It runs
+// through every digit that matters for 32 bits since zeros get scrambled too.
+func owenScrambledRadicalInverse(base, index uint64, hash uint32) float64 {
+	digits := int(math.Ceil(32 * math.Ln2 / math.Log(float64(base))))
+	invBase := 1 / float64(base)
+	invBaseN := 1.0
+	var reversed uint64
+	for i := 0; i < digits; i++ {
+		next := index / base
+		digit := uint32(index - next*base)
+		digitHash := uint32(mixBits(uint64(hash) ^ reversed))
+		digit = permutationElement(digit, uint32(base), digitHash)
+		reversed = reversed*base + uint64(digit)
+		invBaseN *= invBase
+		index = next
+	}
+	return math.Min(float64(reversed)*invBaseN, oneMinusEpsilon)
+}
+
+func mixBits(v uint64) uint64 {
+	v ^= v >> 31
+	v *= 0x7fb5d329728ea185
+	v ^= v >> 27
+	v *= 0x81dadef4bc2dd44d
+	v ^= v >> 33
+	return v
+}
+
+// sobolSampler pads 1D and 2D Sobol points: every dimension gets its own
+// shuffled sample order and Owen scrambling, so the first two Sobol dimensions
+// can be reused for all of them without correlation
+type sobolSampler struct {
+	seed      uint64
+	x, y      int
+	index     uint32
+	dimension int
+}
+
+func (s *sobolSampler) StartPixelSample(x, y, index int) {
+	s.x, s.y, s.index, s.dimension = x, y, uint32(index), 0
+}
+
+func (s *sobolSampler) Get1D() float64 {
+	hash := dimensionHash(s.seed, s.x, s.y, s.dimension)
+	s.dimension++
+	index := owenScramble(s.index, hash)
+	return toUnitFloat(owenScramble(bits.Reverse32(index), hash*0x9e3779b9+1))
+}
+
+func (s *sobolSampler) Get2D() Vec2 {
+	hash := dimensionHash(s.seed, s.x, s.y, s.dimension)
+	s.dimension += 2
+	index := owenScramble(s.index, hash)
+	return Vec2{
+		toUnitFloat(owenScramble(bits.Reverse32(index), hash*0x9e3779b9+1)),
+		toUnitFloat(owenScramble(sobolSecondDimension(index), hash*0x85ebca6b+2)),
+	}
+}
+
+// sobolSecondDimension multiplies index by the generator matrix of Sobol dimension 1
+func sobolSecondDimension(index uint32) uint32 {
+	var result uint32
+	v := uint32(1) << 31
+	for ; index != 0; index >>= 1 {
+		if index&1 != 0 {
+			result ^= v
+		}
+		v ^= v >> 1
+	}
+	return result
+}
+
+// owenScramble is Laine and Karras' hash based nested uniform scramble, applied
+// to the bits of v read from the most significant one down
+func owenScramble(v, seed uint32) uint32 {
+	v = bits.Reverse32(v)
+	v += seed
+	v ^= v * 0x6c50b47c
+	v ^= v * 0xb82f1e52
+	v ^= v * 0xc7afe638
+	v ^= v * 0x8d22f6e6
+	return bits.Reverse32(v)
+}
+
+const oneMinusEpsilon = 0x1.fffffffffffffp-1
+
+func toUnitFloat(v uint32) float64 {
+	return math.Min(float64(v)/(1<<32), oneMinusEpsilon)
+}
+
+// permutationElement returns where i lands in a random permutation of [0, l)
+// chosen by p, without building the permutation (Kensler's hash)
+func permutationElement(i, l, p uint32) uint32 {
+	w := l - 1
+	w |= w >> 1
+	w |= w >> 2
+	w |= w >> 4
+	w |= w >> 8
+	w |= w >> 16
+	for {
+		i ^= p
+		i *= 0xe170893d
+		i ^= p >> 16
+		i ^= (i & w) >> 4
+		i ^= p >> 8
+		i *= 0x0929eb3f
+		i ^= p >> 23
+		i ^= (i & w) >> 1
+		i *= 1 | p>>27
+		i *= 0x6935fa69
+		i ^= (i & w) >> 11
+		i *= 0x74dcb303
+		i ^= (i & w) >> 2
+		i *= 0x9e501cc3
+		i ^= (i & w) >> 2
+		i *= 0xc860a3df
+		i &= w
+		i ^= i >> 5
+		if i < l {
+			break
+		}
+	}
+	return (i + p) % l
+}
+
+// SampleUniformSphere maps u to a uniformly distributed unit vector
+func SampleUniformSphere(u Vec2) Vec3 {
+	z := 1 - 2*u.X
+	r := math.Sqrt(math.Max(0, 1-z*z))
+	phi := 2 * pi * u.Y
+	return Vec3{r * math.Cos(phi), r * math.Sin(phi), z}
+}
+
+// SampleUnitDisk maps u to the unit disk with Shirley's concentric mapping,
+// which keeps strata intact unlike rejection sampling
+func SampleUnitDisk(u Vec2) Vec3 {
+	ox := 2*u.X - 1
+	oy := 2*u.Y - 1
+	if ox == 0 && oy == 0 {
+		return Vec3{}
+	}
+	var r, theta float64
+	if math.Abs(ox) > math.Abs(oy) {
+		r = ox
+		theta = pi / 4 * (oy / ox)
+	} else {
+		r = oy
+		theta = pi/2 - pi/4*(ox/oy)
+	}
+	return Vec3{r * math.Cos(theta), r * math.Sin(theta), 0}
+}
+
+// SampleCosineHemisphere maps u to a cosine distributed direction around +Z
+func SampleCosineHemisphere(u Vec2) Vec3 {
+	d := SampleUnitDisk(u)
+	d.Z = math.Sqrt(math.Max(0, 1-d.X*d.X-d.Y*d.Y))
+	return d
+}
@@ -0,0 +1,110 @@
+package utils
+
+import "testing"
+
+var samplerTypes = []SamplerType{RandomSampler, SobolSampler, HaltonSampler, StratifiedSampler}
+
+// drawSamples takes the first dimensions of one pixel sample, the way a path
+// asks for them
+func drawSamples(s Sampler, x, y, index int) []float64 {
+	s.StartPixelSample(x, y, index)
+	var values []float64
+	for i := 0; i < 12; i++ {
+		if i%3 == 0 {
+			values = append(values, s.Get1D())
+			continue
+		}
+		u := s.Get2D()
+		values = append(values, u.X, u.Y)
+	}
+	// Past the Halton primes every sampler falls back on something
+	for i := 0; i < 40; i++ {
+		values = append(values, s.Get1D())
+	}
+	return values
+}
+
+func TestSamplersDeterministic(t *testing.T) {
+	for _, st := range samplerTypes {
+		t.Run(st.String(), func(t *testing.T) {
+			a := NewSampler(st, 16, 7)
+			b := NewSampler(st, 16, 7)
+			// b sees the samples in another order, which must not matter
+			for _, index := range []int{15, 3, 0, 40} {
+				drawSamples(b, 9, 2, index)
+			}
+			for index := 0; index < 20; index++ {
+				want := drawSamples(a, 3, 5, index)
+				got := drawSamples(b, 3, 5, index)
+				for i := range want {
+					if got[i] != want[i] {
+						t.Fatalf("sample %d dimension %d = %v on the second sampler, %v on the first", index, i, got[i], want[i])
+					}
+				}
+			}
+
+			other := drawSamples(NewSampler(st, 16, 8), 3, 5, 0)
+			same := 0
+			for i, v := range drawSamples(a, 3, 5, 0) {
+				if other[i] == v {
+					same++
+				}
+			}
+			if same > 2 {
+				t.Errorf("seeds 7 and 8 share %d of %d values", same, len(other))
+			}
+		})
+	}
+}
+
+func TestSamplersRange(t *testing.T) {
+	for _, st := range samplerTypes {
+		t.Run(st.String(), func(t *testing.T) {
+			s := NewSampler(st, 64, 1)
+			for pixel := 0; pixel < 16; pixel++ {
+				for index := 0; index < 80; index++ {
+					for i, v := range drawSamples(s, pixel%4, pixel/4, index) {
+						if v < 0 || v >= 1 {
+							t.Fatalf("pixel %d sample %d dimension %d = %v, want [0, 1)", pixel, index, i, v)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestSamplersStratify checks the low discrepancy samplers put exactly one of
+// n samples in each of n equal intervals of their first dimension and, with
+// grid2D, in each cell of an 8 by 8 grid over their first 2D dimension
+func TestSamplersStratify(t *testing.T) {
+	const n = 64
+	tests := []struct {
+		sampler SamplerType
+		grid2D  bool
+	}{
+		{SobolSampler, true},
+		{HaltonSampler, false},
+		{StratifiedSampler, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sampler.String(), func(t *testing.T) {
+			s := NewSampler(tt.sampler, n, 3)
+			var strata, cells [n]int
+			for index := 0; index < n; index++ {
+				s.StartPixelSample(6, 1, index)
+				strata[int(s.Get1D()*n)]++
+				u := s.Get2D()
+				cells[int(u.Y*8)*8+int(u.X*8)]++
+			}
+			for i := range strata {
+				if strata[i] != 1 {
+					t.Fatalf("interval %d holds %d samples, want 1: %v", i, strata[i], strata)
+				}
+				if tt.grid2D && cells[i] != 1 {
+					t.Fatalf("grid cell %d holds %d samples, want 1: %v", i, cells[i], cells)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+)
+
+// ShutterCurve is how far open the shutter is over the time it is open, which
+// decides how much each moment adds to motion blur
+type ShutterCurve int
+
+const (
+	ShutterBox      ShutterCurve = iota // fully open at once for the whole interval
+	ShutterTriangle                     // opens linearly to the middle and closes again
+	ShutterSmooth                       // opens and closes along a raised cosine, soft streak ends
+)
+
+var shutterCurveNames = map[ShutterCurve]string{
+	ShutterBox:      "box",
+	ShutterTriangle: "triangle",
+	ShutterSmooth:   "smooth",
+}
+
+func (s ShutterCurve) String() string {
+	if name, ok := shutterCurveNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("ShutterCurve(%d)", int(s))
+}
+
+func ParseShutterCurve(name string) (ShutterCurve, error) {
+	for s, n := range shutterCurveNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown shutter curve %q, expected box, triangle or smooth", name)
+}
+
+// sample maps u to a point in the open interval from 0 to 1, spread like the
+// curve. It inverts the curve's integral so every sample keeps the same
+// weight and stratified u stay stratified.
+func (s ShutterCurve) sample(u float64) float64 {
+	switch s {
+	case ShutterTriangle:
+		if u < 0.5 {
+			return math.Sqrt(u / 2)
+		}
+		return 1 - math.Sqrt((1-u)/2)
+	case ShutterSmooth:
+		// The integral t - sin(2 pi t) / 2 pi has no closed inverse, it only
+		// grows so bisection finds it even where the curve is flat
+		lo, hi := 0.0, 1.0
+		for i := 0; i < 32; i++ {
+			t := (lo + hi) / 2
+			if t-math.Sin(2*pi*t)/(2*pi) < u {
+				lo = t
+			} else {
+				hi = t
+			}
+		}
+		return (lo + hi) / 2
+	}
+	return u
+}
+
+// shutterTime is the scene time a camera ray with time sample u is taken at
+func (c *Camera) shutterTime(u float64) float64 {
+	open, close := c.ShutterOpen, c.ShutterClose
+	if open == 0 && close == 0 {
+		close = 1
+	}
+	return open + (close-open)*c.ShutterCurve.sample(u)
+}
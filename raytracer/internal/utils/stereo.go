@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+)
+
+// StereoMode is how the two eyes of a stereo render share the image. The
+// image size and aspect ratio are those of the composed image, which has to
+// split evenly between the eyes.
+type StereoMode int
+
+const (
+	StereoOff        StereoMode = iota // a single view
+	StereoSideBySide                   // left eye on the left half, right eye on the right
+	StereoOverUnder                    // left eye on the top half, right eye on the bottom
+)
+
+var stereoNames = map[StereoMode]string{
+	StereoOff:        "off",
+	StereoSideBySide: "side-by-side",
+	StereoOverUnder:  "over-under",
+}
+
+func (m StereoMode) String() string {
+	if name, ok := stereoNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("StereoMode(%d)", int(m))
+}
+
+func ParseStereoMode(name string) (StereoMode, error) {
+	for m, n := range stereoNames {
+		if n == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown stereo mode %q, expected off, side-by-side or over-under", name)
+}
+
+const defaultInterocularDistance = 0.065
+
+// eyeSize is the size of the image each eye gets
+func (c *Camera) eyeSize() (width, height int) {
+	switch c.Stereo {
+	case StereoSideBySide:
+		return max(1, c.ImageWidth/2), c.imageHeight
+	case StereoOverUnder:
+		return c.ImageWidth, max(1, c.imageHeight/2)
+	}
+	return c.ImageWidth, c.imageHeight
+}
+
+// eyePixel maps pixel i, j of the composed image to the pixel of the eye it
+// belongs to. eye is -1 for the left eye, 1 for the right and 0 without stereo.
+func (c *Camera) eyePixel(i, j int) (x, y int, eye float64) {
+	switch c.Stereo {
+	case StereoSideBySide:
+		if i < c.eyeWidth {
+			return i, j, -1
+		}
+		return i - c.eyeWidth, j, 1
+	case StereoOverUnder:
+		if j < c.eyeHeight {
+			return i, j, -1
+		}
+		return i, j - c.eyeHeight, 1
+	}
+	return i, j, 0
+}
+
+// eyeBounds is the part of a width by height image that holds the eye pixel
+// x, y belongs to. Filters stay inside it so the eyes don't bleed into each
+// other across the seam.
+func eyeBounds(mode StereoMode, width, height, x, y int) image.Rectangle {
+	switch mode {
+	case StereoSideBySide:
+		half := max(1, width/2)
+		if x < half {
+			return image.Rect(0, 0, half, height)
+		}
+		return image.Rect(half, 0, width, height)
+	case StereoOverUnder:
+		half := max(1, height/2)
+		if y < half {
+			return image.Rect(0, 0, width, half)
+		}
+		return image.Rect(0, half, width, height)
+	}
+	return image.Rect(0, 0, width, height)
+}
+
+func (c *Camera) interocularDistance() float64 {
+	if c.InterocularDistance > 0 {
+		return c.InterocularDistance
+	}
+	return defaultInterocularDistance
+}
+
+func (c *Camera) convergence() float64 {
+	if c.Convergence > 0 {
+		return c.Convergence
+	}
+	return c.Focusdist
+}
+
+// offAxisEye moves a ray from origin through the point pixel on the focus
+// plane to the given eye. The eyes keep parallel view directions and shift
+// their frusta instead of toeing in, so both see the pixel's point at the
+// convergence distance in the same place and there is no vertical parallax.
+// It returns the eye's origin and the point it focuses on.
+func (c *Camera) offAxisEye(origin, pixel Vec3, eye float64) (Vec3, Vec3) {
+	convergence := c.convergence()
+	target := origin.PlusEq(pixel.MinusEq(origin).TimesConst(convergence / c.Focusdist))
+	eyeOrigin := origin.PlusEq(c.u.TimesConst(eye * c.interocularDistance() / 2))
+	return eyeOrigin, eyeOrigin.PlusEq(target.MinusEq(eyeOrigin).TimesConst(c.Focusdist / convergence))
+}
+
+// odsEye turns a panoramic ray direction into the given eye's ray for
+// omnidirectional stereo: every direction is seen from the point on the
+// viewing circle whose tangent it is, so the eyes are side by side whichever
+// way the viewer turns. Rays straight up or down get no offset. Both eyes
+// turn in to meet at the convergence distance.
+func (c *Camera) odsEye(dir Vec3, eye float64) (origin, direction Vec3) {
+	dir = dir.UnitVector()
+	horizontal := dir.MinusEq(c.v.TimesConst(dir.Dot(c.v)))
+	if horizontal.Length() < 1e-9 {
+		return c.center, dir
+	}
+	offset := horizontal.Cross(c.v).UnitVector().TimesConst(eye * c.interocularDistance() / 2)
+	return c.center.PlusEq(offset), dir.TimesConst(c.convergence()).MinusEq(offset)
+}
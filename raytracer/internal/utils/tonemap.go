@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+type ToneMapOperator int
+
+const (
+	ToneMapACES             ToneMapOperator = iota // Narkowicz's fit of the ACES filmic curve
+	ToneMapClamp                                   // linear, clipped at the white point
+	ToneMapReinhard                                // L / (1 + L) on luminance
+	ToneMapReinhardExtended                        // Reinhard that reaches white at the white point
+	ToneMapHable                                   // Hable's Uncharted 2 filmic curve
+	ToneMapAgX                                     // Sobotka's AgX, keeps saturated highlights from skewing hue
+)
+
+var toneMapNames = map[ToneMapOperator]string{
+	ToneMapACES:             "aces",
+	ToneMapClamp:            "clamp",
+	ToneMapReinhard:         "reinhard",
+	ToneMapReinhardExtended: "reinhard-extended",
+	ToneMapHable:            "hable",
+	ToneMapAgX:              "agx",
+}
+
+func (o ToneMapOperator) String() string {
+	if name, ok := toneMapNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("ToneMapOperator(%d)", int(o))
+}
+
+func ParseToneMapOperator(name string) (ToneMapOperator, error) {
+	for o, n := range toneMapNames {
+		if n == name {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown tone mapping operator %q, expected aces, clamp, reinhard, reinhard-extended, hable or agx", name)
+}
+
+// ToneMapper turns linear radiance into displayable sRGB, the zero value is
+// ACES at exposure 0
+type ToneMapper struct {
+	Operator ToneMapOperator
+	// Exposure in stops, every +1 doubles the brightness before the curve
+	Exposure float64
+	// WhitePoint is the linear value shown as pure white by clamp, extended
+	// Reinhard and Hable. 0 picks 1, 4 and 11.2 respectively.
+	WhitePoint float64
+}
+
+// Apply maps a linear color to linear display values in [0, 1]
+func (t ToneMapper) Apply(c Vec3) Vec3 {
+	c = c.TimesConst(math.Exp2(t.Exposure))
+	c = Vec3{math.Max(0, c.X), math.Max(0, c.Y), math.Max(0, c.Z)}
+
+	switch t.Operator {
+	case ToneMapClamp:
+		c = c.TimesConst(1 / t.white(1))
+	case ToneMapReinhard:
+		l := luminance(c)
+		c = c.TimesConst(1 / (1 + l))
+	case ToneMapReinhardExtended:
+		l := luminance(c)
+		w := t.white(4)
+		c = c.TimesConst((1 + l/(w*w)) / (1 + l))
+	case ToneMapHable:
+		// Hable's curve expects the scene exposed one stop up
+		scale := 1 / hable(t.white(11.2))
+		c = Vec3{hable(2*c.X) * scale, hable(2*c.Y) * scale, hable(2*c.Z) * scale}
+	case ToneMapAgX:
+		c = agx(c)
+	default:
+		c = ACESToneMap(c)
+	}
+	return Vec3{math.Min(c.X, 1), math.Min(c.Y, 1), math.Min(c.Z, 1)}
+}
+
+func (t ToneMapper) white(fallback float64) float64 {
+	if t.WhitePoint > 0 {
+		return t.WhitePoint
+	}
+	return fallback
+}
+
+// Color is the 8 bit sRGB color shown for a linear color
+func (t ToneMapper) Color(c Vec3) color.RGBA {
+	c = t.Apply(c)
+	return color.RGBA{
+		R: uint8(math.Round(255 * LinearToSRGB(c.X))),
+		G: uint8(math.Round(255 * LinearToSRGB(c.Y))),
+		B: uint8(math.Round(255 * LinearToSRGB(c.Z))),
+		A: 255,
+	}
+}
+
+// Image tone maps a whole framebuffer
+func (t ToneMapper) Image(f *Framebuffer) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, f.Width, f.Height))
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			img.SetRGBA(x, y, t.Color(f.At(x, y)))
+		}
+	}
+	return img
+}
+
+func hable(x float64) float64 {
+	const a, b, c, d, e, f = 0.15, 0.50, 0.10, 0.20, 0.02, 0.30
+	return (x*(a*x+c*b)+d*e)/(x*(a*x+b)+d*f) - e/f
+}
+
+// agxInset and agxOutset are the AgX base contrast matrices, row major
+var (
+	agxInset = [3]Vec3{
+		{0.842479062253094, 0.0784335999999992, 0.0792237451477643},
+		{0.0423282422610123, 0.878468636469772, 0.0791661274605434},
+		{0.0423756549057051, 0.0784336, 0.879142973793104},
+	}
+	agxOutset = [3]Vec3{
+		{1.19687900512017, -0.0980208811401368, -0.0990297440797205},
+		{-0.0528968517574562, 1.15190312990417, -0.0989611768448433},
+		{-0.0529716355144438, -0.0980434501171241, 1.15107367264116},
+	}
+)
+
+// agx squeezes the color into a log encoded range, applies the AgX sigmoid
+// (as a polynomial fit) and undoes the inset, following Wrensch's port
+func agx(c Vec3) Vec3 {
+	const minEV, maxEV = -12.47393, 4.026069
+	c = Vec3{agxInset[0].Dot(c), agxInset[1].Dot(c), agxInset[2].Dot(c)}
+
+	curve := func(v float64) float64 {
+		v = (math.Max(minEV, math.Min(maxEV, math.Log2(math.Max(v, 1e-10)))) - minEV) / (maxEV - minEV)
+		v2 := v * v
+		v4 := v2 * v2
+		return 15.5*v4*v2 - 40.14*v4*v + 31.96*v4 - 6.868*v2*v + 0.4298*v2 + 0.1191*v - 0.00232
+	}
+	c = Vec3{curve(c.X), curve(c.Y), curve(c.Z)}
+	c = Vec3{agxOutset[0].Dot(c), agxOutset[1].Dot(c), agxOutset[2].Dot(c)}
+
+	// The sigmoid produces display encoded values, go back to linear
+	return Vec3{
+		math.Pow(math.Max(0, c.X), 2.2),
+		math.Pow(math.Max(0, c.Y), 2.2),
+		math.Pow(math.Max(0, c.Z), 2.2),
+	}
+}
@@ -0,0 +1,52 @@
+package utils
+
+import "fmt"
+
+// Transform is an instance of Object placed in the world with an affine matrix
+type Transform struct {
+	Object        Hittable
+	objectToWorld Mat4
+	worldToObject Mat4
+	normalToWorld Mat4
+	bbox          AABB
+}
+
+// NewTransform wraps object with objectToWorld, for example
+// Translation(offset).Mul(RotationY(15)) rotates first and then moves.
+// A singular matrix is an error since nothing sensible can be rendered.
+func NewTransform(object Hittable, objectToWorld Mat4) (*Transform, error) {
+	worldToObject, ok := objectToWorld.Inverse()
+	if !ok {
+		return nil, fmt.Errorf("transform matrix is not invertible: %v", objectToWorld)
+	}
+	return &Transform{
+		Object:        object,
+		objectToWorld: objectToWorld,
+		worldToObject: worldToObject,
+		normalToWorld: worldToObject.Transpose(),
+		bbox:          objectToWorld.TransformBox(object.BoundingBox()),
+	}, nil
+}
+
+func (t *Transform) BoundingBox() AABB {
+	return t.bbox
+}
+
+func (t *Transform) Hit(r *Ray, rayT Interval, rec *HitRecord) bool {
+	// The direction is not normalized so t values stay the same in both spaces
+	objectRay := Ray{
+		t.worldToObject.TransformPoint(r.Origin),
+		t.worldToObject.TransformVector(r.Direction),
+		r.Tm,
+		r.Rng,
+	}
+
+	if !t.Object.Hit(&objectRay, rayT, rec) {
+		return false
+	}
+
+	// Normals go through the inverse transpose, the side they face doesn't change
+	rec.P = t.objectToWorld.TransformPoint(rec.P)
+	rec.Normal = t.normalToWorld.TransformVector(rec.Normal).UnitVector()
+	return true
+}
@@ -0,0 +1,59 @@
+package utils
+
+import "math"
+
+// transformedLight is a light inside a Transform or Motion seen from the
+// world, so lights placed with a matrix can still be sampled directly
+type transformedLight struct {
+	*Transform // with the light as its Object
+	light      Light
+	// det is the determinant of objectToWorld without its translation, how
+	// much it scales volumes
+	det float64
+}
+
+func newTransformedLight(light Light, objectToWorld, worldToObject Mat4) *transformedLight {
+	x := objectToWorld.TransformVector(Vec3{1, 0, 0})
+	y := objectToWorld.TransformVector(Vec3{0, 1, 0})
+	z := objectToWorld.TransformVector(Vec3{0, 0, 1})
+	return &transformedLight{
+		Transform: &Transform{
+			Object:        light,
+			objectToWorld: objectToWorld,
+			worldToObject: worldToObject,
+			normalToWorld: worldToObject.Transpose(),
+			bbox:          objectToWorld.TransformBox(light.BoundingBox()),
+		},
+		light: light,
+		det:   math.Abs(x.Dot(y.Cross(z))),
+	}
+}
+
+// Light places light, which lies in t's object space, in the world
+func (t *Transform) Light(light Light) Light {
+	return newTransformedLight(light, t.objectToWorld, t.worldToObject)
+}
+
+// Light places light, which lies in m's object space, in the world. Like
+// moving spheres it is sampled where it is at time 0.
+func (m *Motion) Light(light Light) Light {
+	pose := m.at(0)
+	return newTransformedLight(light, pose.objectToWorld(), pose.worldToObject())
+}
+
+// PDFValue takes the light's density in object space over to the world. A
+// linear map A spreads the directions around w by |det A| / |A w|^3.
+func (l *transformedLight) PDFValue(origin, direction Vec3, rng *RNG) float64 {
+	objectDirection := l.worldToObject.TransformVector(direction)
+	pdf := l.light.PDFValue(l.worldToObject.TransformPoint(origin), objectDirection, rng)
+	if pdf == 0 {
+		return 0
+	}
+	stretch := l.objectToWorld.TransformVector(objectDirection.UnitVector()).Length()
+	return pdf * stretch * stretch * stretch / l.det
+}
+
+func (l *transformedLight) Random(origin Vec3, u Vec2) Vec3 {
+	direction := l.light.Random(l.worldToObject.TransformPoint(origin), u)
+	return l.objectToWorld.TransformVector(direction)
+}
@@ -1,12 +1,13 @@
 package utils
 
+// Translate moves Object by Offset, use Transform for rotation and scaling
 type Translate struct {
 	Offset Vec3
 	Object Hittable
 }
 
 func (t *Translate) Hit(r *Ray, rayT Interval, rec *HitRecord) bool {
-	offsetR := Ray{r.Origin.MinusEq(t.Offset), r.Direction, r.Tm}
+	offsetR := Ray{r.Origin.MinusEq(t.Offset), r.Direction, r.Tm, r.Rng}
 
 	if !t.Object.Hit(&offsetR, rayT, rec) {
 		return false
@@ -14,3 +15,7 @@ func (t *Translate) Hit(r *Ray, rayT Interval, rec *HitRecord) bool {
 	rec.P = rec.P.PlusEq(t.Offset)
 	return true
 }
+
+func (t *Translate) BoundingBox() AABB {
+	return Translation(t.Offset).TransformBox(t.Object.BoundingBox())
+}
@@ -56,14 +56,6 @@ func (v Vec3) Cross(v2 Vec3) Vec3 {
 func (v Vec3) UnitVector() Vec3 {
 	return v.TimesConst(1.0 / v.Length())
 }
-func RandomInUnitDisk() Vec3 {
-	for {
-		p := Vec3{X: RandomFloatInRange(-1, 1), Y: RandomFloatInRange(-1, 1)}
-		if p.LengthSquared() < 1 {
-			return p
-		}
-	}
-}
 func (v Vec3) Normalize() Vec3 {
 	l := v.Length()
 	return Vec3{v.X / l, v.Y / l, v.Z / l}
@@ -72,29 +64,6 @@ func (v Vec3) NearZero() bool {
 	s := 1e-8
 	return (math.Abs(v.X) < s) && (math.Abs(v.Y) < s) && (math.Abs(v.Z) < s)
 }
-func RandomVec3() Vec3 {
-	return Vec3{RandomFloat(), RandomFloat(), RandomFloat()}
-}
-func RandomVec3InRange(min, max float64) Vec3 {
-	return Vec3{RandomFloatInRange(min, max), RandomFloatInRange(min, max), RandomFloatInRange(min, max)}
-}
-func RandomUnitVector() Vec3 {
-	for {
-		p := RandomVec3InRange(-1, 1)
-		lensq := p.LengthSquared()
-		if 1e-160 < lensq && lensq <= 1 {
-			return p.TimesConst(1 / math.Sqrt(lensq))
-		}
-	}
-}
-func RandomOnHemisphere(normal Vec3) Vec3 {
-	onUnitSphere := RandomUnitVector()
-	if onUnitSphere.Dot(normal) > 0.0 {
-		return onUnitSphere
-	} else {
-		return onUnitSphere.Neg()
-	}
-}
 func Reflect(v, n Vec3) Vec3 {
 	return v.MinusEq(n.TimesConst(v.Dot(n) * 2))
 }